@@ -2,7 +2,7 @@ package main
 
 import (
 	"fmt"
-	"os/exec"
+	"net"
 	"time"
 
 	"github.com/zan8in/oobadapter/pkg/oobadapter"
@@ -12,11 +12,13 @@ import (
 func main() {
 	oob, err := oobadapter.NewOOBAdapter("interactsh", &oobadapter.ConnectorParams{
 		Domain: "oast.pro",
+		// SessionFile: "interactsh-session.yaml", // 保存会话，重启后继续轮询
 	})
 	if err != nil {
 		fmt.Printf("[init] err=%v\n", err)
 		return
 	}
+	defer oob.Close()
 	fmt.Printf("[init] adapter=interactsh alive=%v\n", oob.IsVaild())
 	if !oob.IsVaild() {
 		return
@@ -28,7 +30,7 @@ func main() {
 	status, _ := retryhttp.Get(d.HTTP)
 	fmt.Printf("[http] trigger_status=%d\n", status)
 
-	_ = exec.Command("ping", "-c", "1", d.DNS).Run()
+	_, _ = net.LookupHost(d.DNS)
 	fmt.Printf("[dns] triggered\n")
 
 	time.Sleep(5 * time.Second)
@@ -2,7 +2,7 @@ package main
 
 import (
 	"fmt"
-	"os/exec"
+	"net"
 	"strings"
 	"time"
 
@@ -16,11 +16,13 @@ func main() {
 		Domain:  "log.xxx.top",
 		HTTPUrl: "http://xxx.com/log",
 		ApiUrl:  "http://xxx.com/xx-ls",
+		// AutoRule: true, // 自动创建 revsuit 规则，Close 时删除
 	})
 	if err != nil {
 		fmt.Printf("[init] err=%v\n", err)
 		return
 	}
+	defer oob.Close()
 
 	fmt.Printf("[init] adapter=revsuit alive=%v\n", oob.IsVaild())
 	if !oob.IsVaild() {
@@ -68,13 +70,12 @@ func runDNSCheck(oob *oobadapter.OOBAdapter) (bool, string) {
 	fmt.Println("------------------------------------------------------------")
 	fmt.Printf("[dns] filter=%s domain=%s\n", d.Filter, d.DNS)
 
-	cmd := exec.Command("ping", "-c", "1", d.DNS)
-	out, err := cmd.CombinedOutput()
+	addrs, err := net.LookupHost(d.DNS)
 	if err != nil {
 		fmt.Printf("[dns] trigger_err=%v\n", err)
 	}
-	if len(out) > 0 {
-		fmt.Printf("[dns] trigger_out=%s\n", trimBody(string(out), 300))
+	if len(addrs) > 0 {
+		fmt.Printf("[dns] trigger_addrs=%s\n", strings.Join(addrs, ","))
 	}
 
 	ok, lastBody := pollValidate(oob, oobadapter.OOBDNS, d.Filter, 15*time.Second, 1*time.Second)
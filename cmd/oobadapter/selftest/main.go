@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/zan8in/oobadapter/pkg/oobadapter"
+)
+
+func main() {
+	dnslogType := flag.String("type", "interactsh", "dnslog type: ceyeio, dnslogcn, alphalog, xray, revsuit, interactsh")
+	key := flag.String("key", "", "api key or token")
+	domain := flag.String("domain", "", "dnslog domain")
+	apiUrl := flag.String("api", "", "api url")
+	httpUrl := flag.String("http", "", "http listener url")
+	proxy := flag.String("proxy", "", "proxy url, http/https/socks5")
+	timeout := flag.Duration("timeout", 30*time.Second, "max wait for the callbacks")
+	flag.Parse()
+
+	oob, err := oobadapter.NewOOBAdapter(*dnslogType, &oobadapter.ConnectorParams{
+		Key:     *key,
+		Domain:  *domain,
+		ApiUrl:  *apiUrl,
+		HTTPUrl: *httpUrl,
+		Proxy:   *proxy,
+	})
+	if err != nil {
+		fmt.Printf("[init] err=%v\n", err)
+		os.Exit(1)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	report := oob.SelfTest(ctx)
+	oob.Close()
+
+	for _, r := range report.Results {
+		fmt.Printf("[%s] target=%s detected=%v latency=%s", r.Protocol, r.Target, r.Detected, r.Latency.Round(time.Millisecond))
+		if r.Err != nil {
+			fmt.Printf(" err=%v", r.Err)
+		}
+		fmt.Println()
+	}
+	fmt.Printf("[selftest] adapter=%s passed=%v\n", report.DnslogType, report.Passed)
+	if !report.Passed {
+		os.Exit(1)
+	}
+}
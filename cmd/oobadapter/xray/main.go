@@ -2,7 +2,7 @@ package main
 
 import (
 	"fmt"
-	"os/exec"
+	"net"
 	"time"
 
 	"github.com/zan8in/oobadapter/pkg/oobadapter"
@@ -57,12 +57,8 @@ func main() {
 	fmt.Println("GetValidationDomain: ", domains)
 
 	// 模拟 dnslog 请求（正式环境无需请求）
-	command := "ping" // Windows系统的查看目录命令
-	args := []string{"-n", "1", domains.DNS}
-	cmd := exec.Command(command, args...)
-	if err := cmd.Start(); err != nil {
-		fmt.Println(err.Error())
-	}
+	// 通过 Go 的解析器发起 dns 查询，NXDOMAIN 不影响记录
+	_, _ = net.LookupHost(domains.DNS)
 	time.Sleep(time.Second * 3)
 
 	// 获取验证结果
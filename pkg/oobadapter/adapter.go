@@ -24,9 +24,12 @@ var (
 )
 
 type OOBAdapter struct {
-	DnsLogType  string
-	Params      *ConnectorParams
-	DnsLogModel interface{}
+	DnsLogType   string
+	Params       *ConnectorParams
+	DnsLogModel  interface{}
+	Correlations *CorrelationStore
+
+	breaker *circuitBreaker
 }
 
 type Record struct {
@@ -44,6 +47,9 @@ func (o *OOBAdapter) Poll(filterType string) ([]byte, error) {
 		Filter:     "",
 		FilterType: filterType,
 	})
+	if res.Err != nil {
+		return nil, res.Err
+	}
 	if res.Body == "" {
 		return nil, nil
 	}
@@ -61,50 +67,40 @@ func (o *OOBAdapter) PollRecords(filterType string) ([]Record, error) {
 	return splitRecordsByType(body, o.DnsLogType), nil
 }
 
+// Match evaluates filter against each record of body rather than the whole body,
+// using the same conditions as the connector's ValidateResult.
 func (o *OOBAdapter) Match(body []byte, filterType string, filter string) bool {
 	if o == nil || len(body) == 0 || filter == "" {
 		return false
 	}
+	return o.MatchWith(body, ValidateParams{Filter: filter, FilterType: filterType})
+}
+
+// MatchWith is Match with the optional per-record conditions of params.Matcher.
+func (o *OOBAdapter) MatchWith(body []byte, params ValidateParams) bool {
+	if o == nil || len(body) == 0 || params.Filter == "" {
+		return false
+	}
+	params = o.withDefaults(params)
+	if o.Params != nil && o.Params.SignFilters && !newFilterSigner(o.Params.SignKey).verifyFilter(params.Filter) {
+		return false
+	}
 
-	blob := strings.ToLower(string(body))
 	switch o.DnsLogType {
 	case CeyeName:
-		return strings.Contains(blob, strings.ToLower(filter+"."))
+		return matchBody(o.DnsLogType, body, params.matcher(o.DnsLogModel.(*CeyeConnector).matcher(params)))
 	case DnslogcnName:
-		return strings.Contains(blob, strings.ToLower(filter))
+		return matchBody(o.DnsLogType, body, params.matcher(o.DnsLogModel.(*DnslogcnConnector).matcher(params)))
 	case AlphalogName:
-		return strings.Contains(blob, strings.ToLower(filter))
+		return matchBody(o.DnsLogType, body, params.matcher(o.DnsLogModel.(*AlphalogConnector).matcher(params)))
 	case XrayName:
-		xray := o.DnsLogModel.(*XrayConnector)
-		if filterType == OOBHTTP {
-			return strings.Contains(blob, strings.ToLower(getXrayHttpSuffix(xray.XrayHTTPUrl)+"/"+filter))
-		}
-		return strings.Contains(blob, strings.ToLower(xray.XrayDNSFilter+"."+filter))
+		return matchBody(o.DnsLogType, body, params.matcher(o.DnsLogModel.(*XrayConnector).matcher(params)))
 	case RevsuitName:
-		if filterType == OOBHTTP {
-			return strings.Contains(blob, strings.ToLower("/log/"+filter))
-		}
-		f := strings.ToLower(strings.TrimSpace(filter))
-		if f == "" {
-			return false
-		}
-		return strings.Contains(blob, `"`+"flag"+`":"`+f+`"`) ||
-			strings.Contains(blob, `"`+"flag"+`":"`+f+`.log"`) ||
-			strings.Contains(blob, f+".")
+		return matchBody(o.DnsLogType, body, params.matcher(o.DnsLogModel.(*RevsuitConnector).matcher(params)))
 	case InteractshName:
-		f := strings.ToLower(strings.TrimSpace(filter))
-		if f == "" {
-			return false
-		}
-		if filterType == OOBDNS {
-			return strings.Contains(blob, f) && strings.Contains(blob, `"`+"protocol"+`":"dns"`)
-		}
-		if filterType == OOBHTTP {
-			return strings.Contains(blob, f) && (strings.Contains(blob, `"`+"protocol"+`":"http"`) || strings.Contains(blob, `"`+"protocol"+`":"https"`))
-		}
-		return strings.Contains(blob, f)
+		return matchBody(o.DnsLogType, body, params.matcher(o.DnsLogModel.(*InteractshConnector).matcher(params)))
 	default:
-		return strings.Contains(blob, strings.ToLower(filter))
+		return strings.Contains(strings.ToLower(string(body)), strings.ToLower(params.Filter))
 	}
 }
 
@@ -114,7 +110,7 @@ func splitRecordsByType(body []byte, dnsLogType string) []Record {
 			return recs
 		}
 	}
-	return splitRecords(body)
+	return splitRecords(body, providerLocation(dnsLogType))
 }
 
 type revsuitPollResponse struct {
@@ -155,7 +151,7 @@ func splitRevsuitRecords(body []byte) []Record {
 			continue
 		}
 
-		at := guessTimeFromMap(it, time.Now().UTC())
+		at := guessTimeFromMap(it, time.Now().UTC(), providerLocation(RevsuitName))
 		if rt, ok := it["request_time"].(string); ok {
 			if ts, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(rt)); err == nil {
 				at = ts.UTC()
@@ -173,7 +169,7 @@ func splitRevsuitRecords(body []byte) []Record {
 	return out
 }
 
-func splitRecords(body []byte) []Record {
+func splitRecords(body []byte, loc *time.Location) []Record {
 	s := strings.TrimSpace(string(body))
 	if s == "" {
 		return nil
@@ -183,7 +179,7 @@ func splitRecords(body []byte) []Record {
 	if strings.HasPrefix(s, "{") || strings.HasPrefix(s, "[") {
 		var v any
 		if err := json.Unmarshal([]byte(s), &v); err == nil {
-			recs := recordsFromJSON(v, now)
+			recs := recordsFromJSON(v, now, loc)
 			if len(recs) > 0 {
 				return recs
 			}
@@ -213,11 +209,11 @@ func splitRecords(body []byte) []Record {
 	}}
 }
 
-func recordsFromJSON(v any, fallback time.Time) []Record {
+func recordsFromJSON(v any, fallback time.Time, loc *time.Location) []Record {
 	switch vv := v.(type) {
 	case map[string]any:
 		if data, ok := vv["data"]; ok {
-			return recordsFromJSON(data, fallback)
+			return recordsFromJSON(data, fallback, loc)
 		}
 		raw, _ := json.Marshal(vv)
 		s := strings.TrimSpace(string(raw))
@@ -225,7 +221,7 @@ func recordsFromJSON(v any, fallback time.Time) []Record {
 			return nil
 		}
 		return []Record{{
-			Timestamp: guessTimeFromMap(vv, fallback),
+			Timestamp: guessTimeFromMap(vv, fallback, loc),
 			Raw:       s,
 			Snippet:   guessSnippetFromMap(vv, s),
 			UniqueKey: guessUniqueFromMap(vv),
@@ -233,7 +229,7 @@ func recordsFromJSON(v any, fallback time.Time) []Record {
 	case []any:
 		out := make([]Record, 0, len(vv))
 		for _, it := range vv {
-			rs := recordsFromJSON(it, fallback)
+			rs := recordsFromJSON(it, fallback, loc)
 			if len(rs) > 0 {
 				out = append(out, rs...)
 			}
@@ -298,7 +294,8 @@ func guessUniqueFromMap(m map[string]any) string {
 	return ""
 }
 
-func guessTimeFromMap(m map[string]any, fallback time.Time) time.Time {
+// guessTimeFromMap reads the record time of m, timestamps without a zone are in loc.
+func guessTimeFromMap(m map[string]any, fallback time.Time, loc *time.Location) time.Time {
 	keys := []string{"time", "timestamp", "created_at", "createdAt"}
 	for _, k := range keys {
 		v, ok := m[k]
@@ -317,8 +314,8 @@ func guessTimeFromMap(m map[string]any, fallback time.Time) time.Time {
 			if ts, err := time.Parse(time.RFC3339, s); err == nil {
 				return ts
 			}
-			if ts, err := time.Parse("2006-01-02 15:04:05", s); err == nil {
-				return ts
+			if ts, err := time.ParseInLocation("2006-01-02 15:04:05", s, loc); err == nil {
+				return ts.UTC()
 			}
 		case float64:
 			if t > 0 {
@@ -333,7 +330,9 @@ func guessTimeFromMap(m map[string]any, fallback time.Time) time.Time {
 	return fallback
 }
 
-func NewOOBAdapter(dnslogType string, params *ConnectorParams) (*OOBAdapter, error) {
+// NewOOBAdapter creates the connector of dnslogType. When it fails, the correlation store
+// and the idle connections of the adapter's client are released.
+func NewOOBAdapter(dnslogType string, params *ConnectorParams) (oob *OOBAdapter, err error) {
 	if dnslogType != InteractshName && len(params.Domain) == 0 {
 		return nil, fmt.Errorf("new OOBAdapter failed, Domain is empty")
 	}
@@ -342,86 +341,158 @@ func NewOOBAdapter(dnslogType string, params *ConnectorParams) (*OOBAdapter, err
 	} else {
 		params.ApiUrl = strings.TrimSuffix(params.ApiUrl, "/")
 	}
+	correlations, err := NewCorrelationStore(params.CorrelationFile)
+	if err != nil {
+		return nil, err
+	}
+	client, err := params.httpClient()
+	if err != nil {
+		_ = correlations.Close()
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			_ = correlations.Close()
+			client.CloseIdleConnections()
+		}
+	}()
+	breaker := newCircuitBreaker(params.BreakerThreshold, params.BreakerCooldown)
+	issued := params.issueLog()
+	signKey := ""
+	if params.SignFilters {
+		if len(params.SignKey) == 0 {
+			if filename := signKeyFile(dnslogType, params); filename != "" {
+				if params.SignKey, err = loadSignKey(filename); err != nil {
+					return nil, err
+				}
+			} else {
+				params.SignKey = NewSignKey()
+			}
+		}
+		signKey = params.SignKey
+	}
 	switch dnslogType {
 	case CeyeName:
-		ceye := NewCeyeConnector(&ConnectorParams{
-			Key:    params.Key,
-			Domain: params.Domain,
-			ApiUrl: params.ApiUrl,
+		ceye, err := NewCeyeConnector(&ConnectorParams{
+			Key:            params.Key,
+			Domain:         params.Domain,
+			ApiUrl:         params.ApiUrl,
+			SignKey:        signKey,
+			client:         client,
+			issued:         issued,
+			RecordCacheTTL: params.RecordCacheTTL,
 		})
+		if err != nil {
+			return nil, err
+		}
 		return &OOBAdapter{
-			DnsLogType:  dnslogType,
-			Params:      params,
-			DnsLogModel: ceye,
+			DnsLogType:   dnslogType,
+			Params:       params,
+			DnsLogModel:  ceye,
+			Correlations: correlations,
+			breaker:      breaker,
 		}, nil
 	case DnslogcnName:
 		dnslogcn, err := NewDnslogcnConnector(&ConnectorParams{
-			Domain: params.Domain,
-			ApiUrl: params.ApiUrl,
+			Domain:         params.Domain,
+			ApiUrl:         params.ApiUrl,
+			SignKey:        signKey,
+			client:         client,
+			issued:         issued,
+			RecordCacheTTL: params.RecordCacheTTL,
 		})
 		if err != nil {
 			return nil, err
 		}
 		return &OOBAdapter{
-			DnsLogType:  dnslogType,
-			Params:      params,
-			DnsLogModel: dnslogcn,
+			DnsLogType:   dnslogType,
+			Params:       params,
+			DnsLogModel:  dnslogcn,
+			Correlations: correlations,
+			breaker:      breaker,
 		}, nil
 	case AlphalogName:
 		alphalog, err := NewAlphalogConnector(&ConnectorParams{
-			Key:    params.Key,
-			Domain: params.Domain,
-			ApiUrl: params.ApiUrl,
+			Key:            params.Key,
+			Domain:         params.Domain,
+			ApiUrl:         params.ApiUrl,
+			SignKey:        signKey,
+			client:         client,
+			issued:         issued,
+			RecordCacheTTL: params.RecordCacheTTL,
 		})
 		if err != nil {
 			return nil, err
 		}
 		return &OOBAdapter{
-			DnsLogType:  dnslogType,
-			Params:      params,
-			DnsLogModel: alphalog,
+			DnsLogType:   dnslogType,
+			Params:       params,
+			DnsLogModel:  alphalog,
+			Correlations: correlations,
+			breaker:      breaker,
 		}, nil
 	case XrayName:
 		xray, err := NewXrayConnector(&ConnectorParams{
-			Key:    params.Key,
-			Domain: params.Domain,
-			ApiUrl: params.ApiUrl,
+			Key:            params.Key,
+			Domain:         params.Domain,
+			ApiUrl:         params.ApiUrl,
+			SignKey:        signKey,
+			client:         client,
+			issued:         issued,
+			RecordCacheTTL: params.RecordCacheTTL,
 		})
 		if err != nil {
 			return nil, err
 		}
 		return &OOBAdapter{
-			DnsLogType:  dnslogType,
-			Params:      params,
-			DnsLogModel: xray,
+			DnsLogType:   dnslogType,
+			Params:       params,
+			DnsLogModel:  xray,
+			Correlations: correlations,
+			breaker:      breaker,
 		}, nil
 	case RevsuitName:
 		revsuit, err := NewRevsuitConnector(&ConnectorParams{
-			Key:     params.Key,
-			Domain:  params.Domain,
-			HTTPUrl: params.HTTPUrl,
-			ApiUrl:  params.ApiUrl,
+			Key:            params.Key,
+			Domain:         params.Domain,
+			HTTPUrl:        params.HTTPUrl,
+			ApiUrl:         params.ApiUrl,
+			AutoRule:       params.AutoRule,
+			SignKey:        signKey,
+			client:         client,
+			issued:         issued,
+			RecordCacheTTL: params.RecordCacheTTL,
 		})
 		if err != nil {
 			return nil, err
 		}
 		return &OOBAdapter{
-			DnsLogType:  dnslogType,
-			Params:      params,
-			DnsLogModel: revsuit,
+			DnsLogType:   dnslogType,
+			Params:       params,
+			DnsLogModel:  revsuit,
+			Correlations: correlations,
+			breaker:      breaker,
 		}, nil
 	case InteractshName:
 		interactsh, err := NewInteractshConnector(&ConnectorParams{
-			Key:    params.Key,
-			Domain: params.Domain,
+			Key:         params.Key,
+			Domain:      params.Domain,
+			SessionFile: params.SessionFile,
+			MaxRecords:  params.MaxRecords,
+			RecordTTL:   params.RecordTTL,
+			SignKey:     signKey,
+			client:      client,
+			issued:      issued,
 		})
 		if err != nil {
 			return nil, err
 		}
 		return &OOBAdapter{
-			DnsLogType:  dnslogType,
-			Params:      params,
-			DnsLogModel: interactsh,
+			DnsLogType:   dnslogType,
+			Params:       params,
+			DnsLogModel:  interactsh,
+			Correlations: correlations,
+			breaker:      breaker,
 		}, nil
 	default:
 		return nil, fmt.Errorf("new oobadapter failed")
@@ -447,7 +518,28 @@ func (o *OOBAdapter) GetValidationDomain() ValidationDomains {
 	}
 }
 
+// ValidateResult fails fast with a *CircuitOpenError in Result.Err while the breaker is open.
 func (o *OOBAdapter) ValidateResult(params ValidateParams) Result {
+	params = o.withDefaults(params)
+	probe, err := o.breaker.allow(o.DnsLogType)
+	if err == nil && probe {
+		err = o.breaker.probed(o.DnsLogType, o.probe())
+	}
+	if err != nil {
+		return Result{
+			IsVaild:    false,
+			DnslogType: o.DnsLogType,
+			FilterType: params.FilterType,
+			Body:       err.Error(),
+			Err:        err,
+		}
+	}
+	res := o.validateResult(params)
+	o.breaker.record(res.Err)
+	return res
+}
+
+func (o *OOBAdapter) validateResult(params ValidateParams) Result {
 	switch o.DnsLogType {
 	case CeyeName:
 		ceye := o.DnsLogModel.(*CeyeConnector)
@@ -477,6 +569,22 @@ func (o *OOBAdapter) ValidateResult(params ValidateParams) Result {
 	}
 }
 
+// withDefaults fills the validation options the caller left empty from the adapter params
+// and the issue time of the filter.
+func (o *OOBAdapter) withDefaults(params ValidateParams) ValidateParams {
+	if o.Params == nil {
+		return params
+	}
+	params = o.Params.issueLog().withIssuedAt(params)
+	if params.ClockSkew == 0 {
+		params.ClockSkew = o.Params.ClockSkew
+	}
+	if params.Classifier == nil {
+		params.Classifier = o.Params.Classifier
+	}
+	return params
+}
+
 func (o *OOBAdapter) IsVaild() bool {
 	switch o.DnsLogType {
 	case CeyeName:
@@ -495,3 +603,24 @@ func (o *OOBAdapter) IsVaild() bool {
 		return false
 	}
 }
+
+// Close stops the background polling, removes the remote sessions and rules and releases
+// the connections of the adapter. It is safe to call more than once.
+func (o *OOBAdapter) Close() error {
+	switch o.DnsLogType {
+	case CeyeName:
+		return o.DnsLogModel.(*CeyeConnector).Close()
+	case DnslogcnName:
+		return o.DnsLogModel.(*DnslogcnConnector).Close()
+	case AlphalogName:
+		return o.DnsLogModel.(*AlphalogConnector).Close()
+	case XrayName:
+		return o.DnsLogModel.(*XrayConnector).Close()
+	case RevsuitName:
+		return o.DnsLogModel.(*RevsuitConnector).Close()
+	case InteractshName:
+		return o.DnsLogModel.(*InteractshConnector).Close()
+	default:
+		return nil
+	}
+}
@@ -1,9 +1,13 @@
 package oobadapter
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/zan8in/oobadapter/pkg/retryhttp"
 	randutil "github.com/zan8in/pins/rand"
@@ -26,6 +30,11 @@ type AlphalogConnector struct {
 	ApiUrl   string // http or https
 	Alphalog Alphalog
 	IsAlive  bool
+	mu       sync.Mutex // guards IsAlive
+	signer   *filterSigner
+	http     *retryhttp.HTTPClient
+	fetches  *recordCache
+	issued   *issueLog
 }
 
 type Alphalog struct {
@@ -36,8 +45,12 @@ type Alphalog struct {
 }
 
 func NewAlphalogConnector(params *ConnectorParams) (*AlphalogConnector, error) {
+	client, err := params.httpClient()
+	if err != nil {
+		return nil, err
+	}
 	apiurl := strings.TrimRight(params.ApiUrl, "/")
-	status, body := retryhttp.Get(fmt.Sprintf("%s/get", apiurl))
+	status, body := client.Get(fmt.Sprintf("%s/get", apiurl))
 	if status == 0 {
 		return nil, fmt.Errorf("new AlphalogConnector failed")
 	}
@@ -54,33 +67,48 @@ func NewAlphalogConnector(params *ConnectorParams) (*AlphalogConnector, error) {
 			Token:    alog.Key,
 			Alphalog: alog,
 			IsAlive:  true,
+			signer:   newFilterSigner(params.SignKey),
+			http:     client,
+			fetches:  newRecordCache(params.RecordCacheTTL),
+			issued:   params.issueLog(),
 		}, nil
 	}
 
 	return nil, fmt.Errorf("new AlphalogConnector failed")
 }
 
+// GetValidationDomain reuses one random token across every payload form, so
+// Filter matches the dns label as well as the ldap/rmi path.
 func (c *AlphalogConnector) GetValidationDomain() ValidationDomains {
-	filter := fmt.Sprintf("%s.%s", randutil.Randcase(AlphalogSubLength), c.Alphalog.Subdomain)
+	filter := c.signer.token(strings.ToLower(randutil.Randcase(AlphalogSubLength)))
+	domain := fmt.Sprintf("%s.%s", filter, c.Alphalog.Subdomain)
 	validationDomain := ValidationDomains{
-		HTTP:   fmt.Sprintf("http://%s", filter),
-		DNS:    filter,
-		JNDI:   fmt.Sprintf("%s/%s", c.Alphalog.Ldap, randutil.Randcase(AlphalogSubLength)),
-		RMI:    fmt.Sprintf("%s/%s", c.Alphalog.Rmi, randutil.Randcase(AlphalogSubLength)),
-		LDAP:   fmt.Sprintf("%s/%s", c.Alphalog.Ldap, randutil.Randcase(AlphalogSubLength)),
-		Filter: filter,
+		HTTP:     fmt.Sprintf("http://%s", domain),
+		DNS:      domain,
+		JNDI:     fmt.Sprintf("%s/%s", c.Alphalog.Ldap, filter),
+		RMI:      fmt.Sprintf("%s/%s", c.Alphalog.Rmi, filter),
+		LDAP:     fmt.Sprintf("%s/%s", c.Alphalog.Ldap, filter),
+		Filter:   filter,
+		IssuedAt: time.Now(),
 	}
+	c.issued.add(validationDomain)
 	return validationDomain
 }
 
 func (c *AlphalogConnector) ValidateResult(params ValidateParams) Result {
+	params = c.issued.withIssuedAt(params)
+	if !c.signer.verifyFilter(params.Filter) {
+		return invalidSignature(AlphalogName, params)
+	}
 	return c.validate(params)
 }
 
 func (c *AlphalogConnector) validate(params ValidateParams) Result {
-	status, body := retryhttp.Post(c.ApiUrl, "key="+c.Token, "")
+	status, body := c.fetches.fetch(c.ApiUrl, func() (int, []byte) {
+		return c.http.Post(c.ApiUrl, "key="+c.Token, "")
+	})
 	if status != 0 {
-		if strings.Contains(strings.ToLower(string(body)), strings.ToLower(params.Filter)) {
+		if matchBody(AlphalogName, body, params.matcher(c.matcher(params))) {
 			return Result{
 				IsVaild:    true,
 				DnslogType: AlphalogName,
@@ -94,6 +122,16 @@ func (c *AlphalogConnector) validate(params ValidateParams) Result {
 		DnslogType: AlphalogName,
 		FilterType: params.FilterType,
 		Body:       string(body),
+		Err:        requestError(AlphalogName, status),
+	}
+}
+
+// matcher matches filter against the part of each record its protocol requested:
+// the dns label, or the ldap/rmi/http path.
+func (c *AlphalogConnector) matcher(params ValidateParams) Matcher {
+	return Matcher{
+		Filter:   params.Filter,
+		Protocol: c.GetFilterType(params.FilterType),
 	}
 }
 
@@ -115,7 +153,51 @@ func (c *AlphalogConnector) GetFilterType(t string) string {
 }
 func (c *AlphalogConnector) IsVaild() bool {
 	if c != nil {
+		c.mu.Lock()
+		defer c.mu.Unlock()
 		return c.IsAlive
 	}
 	return false
 }
+
+// Close drops the cached records and the idle connections.
+func (c *AlphalogConnector) Close() error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	if !c.IsAlive {
+		c.mu.Unlock()
+		return nil
+	}
+	c.IsAlive = false
+	c.mu.Unlock()
+	c.fetches.reset()
+	c.http.CloseIdleConnections()
+	return nil
+}
+
+// health checks the records api with the key issued on creation.
+func (c *AlphalogConnector) health(ctx context.Context) (HealthStep, HealthStep) {
+	api, resp := apiStep(ctx, c.http, retryhttp.Request{
+		Method:      http.MethodPost,
+		URL:         c.ApiUrl,
+		Body:        "key=" + c.Token,
+		ContentType: "application/x-www-form-urlencoded",
+	})
+	if resp == nil {
+		return api, credentialStep(nil, false, "")
+	}
+	msg, ok := apiError(resp.Body)
+	switch {
+	case !ok:
+		return api, credentialStep(resp, false, "invalid response")
+	case msg != "":
+		return api, credentialStep(resp, false, msg)
+	}
+	return api, credentialStep(resp, true, "key valid")
+}
+
+func (c *AlphalogConnector) delegation() (string, []string) {
+	return c.Domain, nil
+}
@@ -0,0 +1,72 @@
+package oobadapter
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// newFakeAlphalog answers /get with a fresh key and the records api with records.
+func newFakeAlphalog(t *testing.T) (*httptest.Server, func(records ...map[string]any)) {
+	t.Helper()
+	var mu sync.Mutex
+	var records []map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/get" {
+			fmt.Fprint(w, `{"key":"k1","subdomain":"a1.alphalog.test","rmi":"rmi://alphalog.test:1099","ldap":"ldap://alphalog.test:1389"}`)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		b, _ := json.Marshal(records)
+		w.Write(b)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func(rs ...map[string]any) {
+		mu.Lock()
+		defer mu.Unlock()
+		records = rs
+	}
+}
+
+func TestAlphalogMatchesRequestedProtocol(t *testing.T) {
+	srv, setRecords := newFakeAlphalog(t)
+	oob, err := NewOOBAdapter(AlphalogName, &ConnectorParams{Domain: "alphalog.test", ApiUrl: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer oob.Close()
+
+	d := oob.GetValidationDomain()
+	token := d.Filter
+	dns := map[string]any{"type": "dns", "subdomain": d.DNS}
+	web := map[string]any{"type": "http", "url": d.HTTP + "/x"}
+	ldap := map[string]any{"type": "ldap", "path": "/" + token}
+
+	cases := []struct {
+		records []map[string]any
+		want    map[string]bool
+	}{
+		{[]map[string]any{dns}, map[string]bool{OOBDNS: true, OOBHTTP: false, OOBLDAP: false, OOBRMI: false}},
+		{[]map[string]any{web}, map[string]bool{OOBDNS: false, OOBHTTP: true, OOBLDAP: false}},
+		{[]map[string]any{ldap}, map[string]bool{OOBDNS: false, OOBHTTP: false, OOBLDAP: true, OOBJNDI: true, OOBRMI: false}},
+		{[]map[string]any{dns, web}, map[string]bool{OOBDNS: true, OOBHTTP: true, OOBLDAP: false}},
+	}
+	for _, c := range cases {
+		setRecords(c.records...)
+		for filterType, want := range c.want {
+			if got := oob.ValidateResult(d.Params(filterType)).IsVaild; got != want {
+				t.Errorf("%v %s: got %v, want %v", c.records, filterType, got, want)
+			}
+		}
+	}
+
+	// the same protocol with another token does not match
+	setRecords(map[string]any{"type": "dns", "subdomain": "other123.a1.alphalog.test"})
+	if oob.ValidateResult(d.Params(OOBDNS)).IsVaild {
+		t.Error("matched another token")
+	}
+}
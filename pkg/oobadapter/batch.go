@@ -0,0 +1,54 @@
+package oobadapter
+
+// GetValidationDomains returns n validation domains.
+func (o *OOBAdapter) GetValidationDomains(n int) []ValidationDomains {
+	out := make([]ValidationDomains, 0, max(n, 0))
+	for i := 0; i < n; i++ {
+		out = append(out, o.GetValidationDomain())
+	}
+	return out
+}
+
+// ValidateBatch fetches the records of each filter type once and evaluates every filter
+// against them locally, so a batch costs one upstream request per filter type instead of
+// one per filter. Results are keyed by filter; a filter checked for several types is valid
+// when any of them hits.
+func (o *OOBAdapter) ValidateBatch(params []ValidateParams) map[string]Result {
+	out := make(map[string]Result, len(params))
+	if o == nil {
+		return out
+	}
+
+	bodies := make(map[string][]byte)
+	errs := make(map[string]error)
+	for _, p := range params {
+		if p.Filter == "" {
+			continue
+		}
+		if o.Params != nil && o.Params.SignFilters && !newFilterSigner(o.Params.SignKey).verifyFilter(p.Filter) {
+			if _, ok := out[p.Filter]; !ok {
+				out[p.Filter] = invalidSignature(o.DnsLogType, p)
+			}
+			continue
+		}
+
+		body, ok := bodies[p.FilterType]
+		if !ok {
+			body, errs[p.FilterType] = o.Poll(p.FilterType)
+			bodies[p.FilterType] = body
+		}
+
+		res := Result{
+			IsVaild:    o.MatchWith(body, p),
+			DnslogType: o.DnsLogType,
+			FilterType: p.FilterType,
+			Body:       string(body),
+			Err:        errs[p.FilterType],
+		}
+		if prev, ok := out[p.Filter]; ok && prev.IsVaild {
+			continue
+		}
+		out[p.Filter] = res
+	}
+	return out
+}
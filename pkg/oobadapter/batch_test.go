@@ -0,0 +1,150 @@
+package oobadapter
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeXray is an xray reverse server that records http hits on /p/ and counts the
+// event list requests per event type.
+type fakeXray struct {
+	*httptest.Server
+	mu    sync.Mutex
+	hits  []map[string]any
+	polls map[string]int
+	fail  bool // the event list answers 503
+}
+
+func newFakeXray(t *testing.T) *fakeXray {
+	t.Helper()
+	f := &fakeXray{polls: make(map[string]int)}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		switch r.URL.Path {
+		case "/_/api/cland/generate/dns_domain":
+			fmt.Fprint(w, `{"code":0,"data":{"prefix":"p-abc"}}`)
+		case "/_/api/cland/generate/http_url":
+			fmt.Fprintf(w, `{"code":0,"data":{"url":"%s/p/abc/G1"}}`, f.URL)
+		case "/_/api/cland/event/list":
+			eventType := r.URL.Query().Get("eventType")
+			f.polls[eventType]++
+			if r.Header.Get("X-Token") != "token" {
+				fmt.Fprint(w, `{"code":1,"msg":"invalid token"}`)
+				return
+			}
+			if f.fail {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			items := []map[string]any{}
+			for _, hit := range f.hits {
+				if hit["protocol"] == eventType {
+					items = append(items, hit)
+				}
+			}
+			b, _ := json.Marshal(map[string]any{"code": 0, "data": map[string]any{"items": items}})
+			w.Write(b)
+		default:
+			f.hits = append(f.hits, map[string]any{
+				"protocol": "http",
+				"url":      f.URL + r.URL.RequestURI(),
+				"method":   r.Method,
+				"time":     time.Now().UTC().Format(time.RFC3339),
+			})
+		}
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+// dnsHit records a dns query of qname.
+func (f *fakeXray) dnsHit(qname string) {
+	f.dnsHitAt(qname, time.Now())
+}
+
+func (f *fakeXray) dnsHitAt(qname string, at time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.hits = append(f.hits, map[string]any{
+		"protocol": "dns",
+		"domain":   qname,
+		"time":     at.UTC().Format(time.RFC3339),
+	})
+}
+
+func (f *fakeXray) setFail(fail bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.fail = fail
+}
+
+func (f *fakeXray) pollCount(eventType string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.polls[eventType]
+}
+
+func newTestXrayAdapter(t *testing.T, f *fakeXray, params *ConnectorParams) *OOBAdapter {
+	t.Helper()
+	if params == nil {
+		params = &ConnectorParams{}
+	}
+	params.Key, params.Domain, params.ApiUrl = "token", "dnslog.test", f.URL
+	oob, err := NewOOBAdapter(XrayName, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { oob.Close() })
+	return oob
+}
+
+func TestValidateBatchFetchesOncePerFilterType(t *testing.T) {
+	f := newFakeXray(t)
+	// no caching, every fetch reaches the server
+	oob := newTestXrayAdapter(t, f, &ConnectorParams{RecordCacheTTL: -1})
+
+	const n = 20
+	domains := oob.GetValidationDomains(n)
+	var params []ValidateParams
+	for i, d := range domains {
+		switch i % 3 {
+		case 0:
+			if _, err := http.Get(d.HTTP); err != nil {
+				t.Fatal(err)
+			}
+		case 1:
+			f.dnsHit(d.DNS)
+		}
+		params = append(params, d.Params(OOBHTTP), d.Params(OOBDNS))
+	}
+
+	results := oob.ValidateBatch(params)
+	if got := f.pollCount("http"); got != 1 {
+		t.Errorf("http fetches: got %d, want 1", got)
+	}
+	if got := f.pollCount("dns"); got != 1 {
+		t.Errorf("dns fetches: got %d, want 1", got)
+	}
+	if len(results) != n {
+		t.Fatalf("results: got %d, want %d", len(results), n)
+	}
+	for i, d := range domains {
+		res, ok := results[d.Filter]
+		if !ok {
+			t.Fatalf("no result for %s", d.Filter)
+		}
+		if want := i%3 != 2; res.IsVaild != want {
+			t.Errorf("%s: valid %v, want %v (%s)", d.Filter, res.IsVaild, want, strings.TrimSpace(res.Body))
+		}
+		if res.Err != nil {
+			t.Errorf("%s: %v", d.Filter, res.Err)
+		}
+	}
+}
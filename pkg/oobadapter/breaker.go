@@ -0,0 +1,197 @@
+package oobadapter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	DefaultBreakerThreshold = 5
+	DefaultBreakerCooldown  = 30 * time.Second
+	BreakerProbeTimeout     = 10 * time.Second // 半开状态下 IsVaild 探测的超时时间
+
+	ErrCircuitOpen = errors.New("oob provider circuit is open")
+)
+
+// BreakerState is the state of an adapter's circuit breaker.
+type BreakerState int
+
+const (
+	BreakerClosed   BreakerState = iota // requests pass
+	BreakerOpen                         // requests fail fast with CircuitOpenError
+	BreakerHalfOpen                     // an IsVaild probe decides whether to close
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// ProviderError is a request to the oob platform api that failed or was throttled.
+type ProviderError struct {
+	DnslogType string
+	Status     int // 0 when no response was received
+}
+
+func (e *ProviderError) Error() string {
+	if e.Status == 0 {
+		return fmt.Sprintf("%s request failed", e.DnslogType)
+	}
+	return fmt.Sprintf("%s request failed, status: %d", e.DnslogType, e.Status)
+}
+
+// requestError returns a *ProviderError when status means the platform did not answer.
+func requestError(dnslogType string, status int) error {
+	if status == 0 || status == http.StatusTooManyRequests || status >= 500 {
+		return &ProviderError{DnslogType: dnslogType, Status: status}
+	}
+	return nil
+}
+
+// CircuitOpenError is returned while the breaker is open, it matches ErrCircuitOpen with errors.Is.
+type CircuitOpenError struct {
+	DnslogType string
+	RetryAt    time.Time // 下一次探测的时间
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("%s circuit is open, retry at %s", e.DnslogType, e.RetryAt.Format(time.RFC3339))
+}
+
+func (e *CircuitOpenError) Unwrap() error {
+	return ErrCircuitOpen
+}
+
+// circuitBreaker opens after threshold consecutive failures. Once the cooldown has passed
+// a single caller probes the provider with IsVaild, the others keep failing fast until the
+// probe closes or reopens the breaker.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	state     BreakerState
+	failures  int
+	openedAt  time.Time
+}
+
+// newCircuitBreaker returns nil when threshold is negative, which disables the breaker.
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	if threshold < 0 {
+		return nil
+	}
+	if threshold == 0 {
+		threshold = DefaultBreakerThreshold
+	}
+	if cooldown <= 0 {
+		cooldown = DefaultBreakerCooldown
+	}
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown}
+}
+
+func (b *circuitBreaker) State() BreakerState {
+	if b == nil {
+		return BreakerClosed
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// allow returns nil when a request may be sent. probe is true for the caller that must
+// probe the provider after the cooldown and pass the outcome to probed.
+func (b *circuitBreaker) allow(dnslogType string) (probe bool, err error) {
+	if b == nil {
+		return false, nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	retryAt := b.openedAt.Add(b.cooldown)
+	switch b.state {
+	case BreakerClosed:
+		return false, nil
+	case BreakerOpen:
+		if time.Now().Before(retryAt) {
+			return false, &CircuitOpenError{DnslogType: dnslogType, RetryAt: retryAt}
+		}
+		b.state = BreakerHalfOpen
+		return true, nil
+	default:
+		return false, &CircuitOpenError{DnslogType: dnslogType, RetryAt: retryAt}
+	}
+}
+
+// probed closes the breaker when the probe succeeded, otherwise reopens it and returns
+// the *CircuitOpenError of the caller.
+func (b *circuitBreaker) probed(dnslogType string, ok bool) error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ok {
+		b.state, b.failures = BreakerClosed, 0
+		return nil
+	}
+	b.state, b.openedAt = BreakerOpen, time.Now()
+	return &CircuitOpenError{DnslogType: dnslogType, RetryAt: b.openedAt.Add(b.cooldown)}
+}
+
+// record counts the outcome of a request and opens the breaker on too many failures.
+// Requests that finish while the breaker is not closed were sent before it opened and
+// are ignored, only the probe decides.
+func (b *circuitBreaker) record(err error) {
+	if b == nil {
+		return
+	}
+	var pe *ProviderError
+	failed := errors.As(err, &pe)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state != BreakerClosed {
+		return
+	}
+	if !failed {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= b.threshold {
+		b.state, b.openedAt = BreakerOpen, time.Now()
+	}
+}
+
+// probe checks the provider with IsVaild. Connectors whose IsVaild only reports the state
+// of the session also have their api requested, as in the api step of HealthCheck.
+func (o *OOBAdapter) probe() bool {
+	if !o.IsVaild() {
+		return false
+	}
+	if o.DnsLogType == CeyeName {
+		// ceye's IsVaild already requests the platform
+		return true
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), BreakerProbeTimeout)
+	defer cancel()
+	api, _ := o.health(ctx)
+	return api.Status != HealthFailed
+}
+
+// BreakerState returns the state of the adapter's circuit breaker.
+func (o *OOBAdapter) BreakerState() BreakerState {
+	if o == nil {
+		return BreakerClosed
+	}
+	return o.breaker.State()
+}
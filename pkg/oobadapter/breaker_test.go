@@ -0,0 +1,94 @@
+package oobadapter
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/zan8in/oobadapter/pkg/retryhttp"
+)
+
+func TestBreakerHalfOpenProbe(t *testing.T) {
+	f := newFakeXray(t)
+	cooldown := 100 * time.Millisecond
+	oob := newTestXrayAdapter(t, f, &ConnectorParams{
+		HTTP:             &retryhttp.Options{Retries: -1, Timeout: 5},
+		RecordCacheTTL:   -1,
+		BreakerThreshold: 2,
+		BreakerCooldown:  cooldown,
+	})
+	// validations fetch http records, the IsVaild probe requests the dns records
+	params := oob.GetValidationDomain().Params(OOBHTTP)
+	validate := func() error { return oob.ValidateResult(params).Err }
+
+	f.setFail(true)
+	for i := 0; i < 2; i++ {
+		var pe *ProviderError
+		if err := validate(); !errors.As(err, &pe) {
+			t.Fatalf("attempt %d: want *ProviderError, got %v", i, err)
+		}
+	}
+	if got := oob.BreakerState(); got != BreakerOpen {
+		t.Fatalf("state: %s, want open", got)
+	}
+	if err := validate(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("want ErrCircuitOpen, got %v", err)
+	}
+	if got := f.pollCount("http"); got != 2 {
+		t.Fatalf("requests while open: got %d, want 2", got)
+	}
+
+	// the probe fails and reopens the breaker, the validation itself is not sent
+	time.Sleep(cooldown)
+	if err := validate(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("failed probe: want ErrCircuitOpen, got %v", err)
+	}
+	if got := oob.BreakerState(); got != BreakerOpen {
+		t.Fatalf("state after failed probe: %s, want open", got)
+	}
+	if probes, validations := f.pollCount("dns"), f.pollCount("http"); probes != 1 || validations != 2 {
+		t.Fatalf("after failed probe: %d probes, %d validations", probes, validations)
+	}
+
+	// a successful probe closes it and the validation goes through
+	f.setFail(false)
+	time.Sleep(cooldown)
+	if err := validate(); err != nil {
+		t.Fatalf("after probe: %v", err)
+	}
+	if got := oob.BreakerState(); got != BreakerClosed {
+		t.Fatalf("state after probe: %s, want closed", got)
+	}
+	if probes, validations := f.pollCount("dns"), f.pollCount("http"); probes != 2 || validations != 3 {
+		t.Fatalf("after probe: %d probes, %d validations", probes, validations)
+	}
+}
+
+func TestBreakerSingleProbe(t *testing.T) {
+	b := newCircuitBreaker(1, time.Millisecond)
+	b.record(&ProviderError{DnslogType: XrayName})
+	time.Sleep(2 * time.Millisecond)
+
+	probe, err := b.allow(XrayName)
+	if err != nil || !probe {
+		t.Fatalf("first caller: probe %v, err %v", probe, err)
+	}
+	if _, err := b.allow(XrayName); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("second caller: want ErrCircuitOpen, got %v", err)
+	}
+	// a request sent before the breaker opened does not decide
+	b.record(nil)
+	if got := b.State(); got != BreakerHalfOpen {
+		t.Fatalf("state: %s, want half-open", got)
+	}
+	if err := b.probed(XrayName, false); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("failed probe: want ErrCircuitOpen, got %v", err)
+	}
+	time.Sleep(2 * time.Millisecond)
+	if probe, _ := b.allow(XrayName); !probe {
+		t.Fatal("no probe after the cooldown")
+	}
+	if err := b.probed(XrayName, true); err != nil || b.State() != BreakerClosed {
+		t.Fatalf("successful probe: %v, state %s", err, b.State())
+	}
+}
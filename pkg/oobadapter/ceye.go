@@ -1,8 +1,12 @@
 package oobadapter
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/zan8in/oobadapter/pkg/retryhttp"
 	randutil "github.com/zan8in/pins/rand"
@@ -20,27 +24,47 @@ type CeyeConnector struct {
 	Token      string // your ceye api token.
 	Domain     string // your ceye identifier.
 	CeyeFilter string // match url name rule, the filter max length is 20.
+	signer     *filterSigner
+	http       *retryhttp.HTTPClient
+	fetches    *recordCache
+	issued     *issueLog
+	mu         sync.Mutex
+	closed     bool
 }
 
-func NewCeyeConnector(params *ConnectorParams) *CeyeConnector {
+func NewCeyeConnector(params *ConnectorParams) (*CeyeConnector, error) {
+	client, err := params.httpClient()
+	if err != nil {
+		return nil, err
+	}
 	return &CeyeConnector{
 		Token:      params.Key,
 		Domain:     params.Domain,
 		CeyeFilter: randutil.Randcase(CeyeSubLength),
-	}
+		signer:     newFilterSigner(params.SignKey),
+		http:       client,
+		fetches:    newRecordCache(params.RecordCacheTTL),
+		issued:     params.issueLog(),
+	}, nil
 }
 func (c *CeyeConnector) GetValidationDomain() ValidationDomains {
-	filter := fmt.Sprintf("%s.%s", randutil.Randcase(CeyeSubLength), c.CeyeFilter)
+	filter := fmt.Sprintf("%s.%s", c.signer.token(randutil.Randcase(CeyeSubLength)), c.CeyeFilter)
 	validationDomain := ValidationDomains{
-		HTTP:   fmt.Sprintf("http://%s.%s", filter, c.Domain),
-		DNS:    fmt.Sprintf("%s.%s", filter, c.Domain),
-		JNDI:   fmt.Sprintf("%s.%s", filter, c.Domain),
-		Filter: filter,
+		HTTP:     fmt.Sprintf("http://%s.%s", filter, c.Domain),
+		DNS:      fmt.Sprintf("%s.%s", filter, c.Domain),
+		JNDI:     fmt.Sprintf("%s.%s", filter, c.Domain),
+		Filter:   filter,
+		IssuedAt: time.Now(),
 	}
+	c.issued.add(validationDomain)
 	return validationDomain
 }
 
 func (c *CeyeConnector) ValidateResult(params ValidateParams) Result {
+	params = c.issued.withIssuedAt(params)
+	if !c.signer.verifyFilter(params.Filter) {
+		return invalidSignature(CeyeName, params)
+	}
 	switch c.GetFilterType(params.FilterType) {
 	case CeyeDNS:
 		return c.validate(params)
@@ -60,10 +84,11 @@ func (c *CeyeConnector) validate(params ValidateParams) Result {
 	// url := fmt.Sprintf("http://api.ceye.io/v1/records?token=%s&type=%s&filter=%s", c.Token, c.GetFilterType(params.FilterType), params.Filter)
 	// 解决 &filter=xxxx 经常显示 500 问题导致漏报问题 @2024/01/06
 	url := fmt.Sprintf("http://api.ceye.io/v1/records?token=%s&type=dns", c.Token)
-	status, body := retryhttp.Get(url)
+	status, body := c.fetches.fetch(url, func() (int, []byte) {
+		return c.http.Get(url)
+	})
 	if status != 0 {
-		//if strings.Contains(strings.ToLower(string(body)), strings.ToLower(params.Filter)) {
-		if strings.Contains(strings.ToLower(string(body)), strings.ToLower(params.Filter+".")) {
+		if matchBody(CeyeName, body, params.matcher(c.matcher(params))) {
 			return Result{
 				IsVaild:    true,
 				DnslogType: CeyeName,
@@ -77,12 +102,24 @@ func (c *CeyeConnector) validate(params ValidateParams) Result {
 		DnslogType: CeyeName,
 		FilterType: params.FilterType,
 		Body:       string(body),
+		Err:        requestError(CeyeName, status),
 	}
 }
 
+// matcher only needs the filter, ceye records are fetched from the dns list for every filter type.
+func (c *CeyeConnector) matcher(params ValidateParams) Matcher {
+	return Matcher{Filter: params.Filter}
+}
+
 func (c *CeyeConnector) IsVaild() bool {
+	c.mu.Lock()
+	closed := c.closed
+	c.mu.Unlock()
+	if closed {
+		return false
+	}
 	// fmt.Println("IsVaild URL: ", fmt.Sprintf("http://%s.%s", randutil.Randcase(6), c.Domain))
-	if status, body := retryhttp.Get(fmt.Sprintf("http://%s.%s", randutil.Randcase(6), c.Domain)); status == 0 {
+	if status, body := c.http.Get(fmt.Sprintf("http://%s.%s", randutil.Randcase(6), c.Domain)); status == 0 {
 		// fmt.Println("IsVaild : ", status, string(body))
 		return false
 	} else {
@@ -94,6 +131,48 @@ func (c *CeyeConnector) IsVaild() bool {
 	return false
 }
 
+// Close drops the cached records and the idle connections, ceye keeps no session.
+func (c *CeyeConnector) Close() error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	c.mu.Unlock()
+	c.fetches.reset()
+	c.http.CloseIdleConnections()
+	return nil
+}
+
+// health checks the records api, ceye reports a bad token in meta.code.
+func (c *CeyeConnector) health(ctx context.Context) (HealthStep, HealthStep) {
+	api, resp := apiStep(ctx, c.http, retryhttp.Request{
+		URL: fmt.Sprintf("http://api.ceye.io/v1/records?token=%s&type=dns", c.Token),
+	})
+	if resp == nil {
+		return api, credentialStep(nil, false, "")
+	}
+	meta := struct {
+		Meta struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"meta"`
+	}{}
+	if err := json.Unmarshal(resp.Body, &meta); err != nil {
+		return api, credentialStep(resp, false, "invalid response: "+err.Error())
+	}
+	return api, credentialStep(resp, meta.Meta.Code == 200, fmt.Sprintf("code: %d, message: %s", meta.Meta.Code, meta.Meta.Message))
+}
+
+// delegation is the ceye zone, the configured domain is an account label under it.
+func (c *CeyeConnector) delegation() (string, []string) {
+	return parentZone(c.Domain), nil
+}
+
 func (c *CeyeConnector) GetFilterType(t string) string {
 	switch t {
 	case OOBHTTP:
@@ -0,0 +1,13 @@
+package oobadapter
+
+import "testing"
+
+func TestNewCeyeConnectorHTTPError(t *testing.T) {
+	if _, err := NewCeyeConnector(&ConnectorParams{Key: "token", Domain: "abc.ceye.io", Proxy: "ftp://127.0.0.1:21"}); err == nil {
+		t.Fatal("invalid proxy accepted")
+	}
+	c, err := NewCeyeConnector(&ConnectorParams{Key: "token", Domain: "abc.ceye.io"})
+	if err != nil || c.Domain != "abc.ceye.io" {
+		t.Fatalf("%+v %v", c, err)
+	}
+}
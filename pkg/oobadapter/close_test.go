@@ -0,0 +1,166 @@
+package oobadapter
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newFakeInteractsh is an interactsh server that accepts any registration and never
+// has interactions. It counts the requests per path.
+func newFakeInteractsh(t *testing.T) (*httptest.Server, func(path string) int) {
+	t.Helper()
+	var mu sync.Mutex
+	calls := make(map[string]int)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls[r.URL.Path]++
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/register":
+			fmt.Fprint(w, `{"message":"registration successful"}`)
+		case "/deregister":
+			fmt.Fprint(w, `{"message":"deregistration successful"}`)
+		case "/poll":
+			fmt.Fprint(w, `{"data":[],"extra":[],"tlddata":[],"aes_key":""}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func(path string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return calls[path]
+	}
+}
+
+// checkGoroutines fails when the goroutine count does not return to base, giving
+// background goroutines a moment to exit.
+func checkGoroutines(t *testing.T, base int) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		n := runtime.NumGoroutine()
+		if n <= base {
+			return
+		}
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<16)
+			t.Fatalf("%d goroutines leaked:\n%s", n-base, buf[:runtime.Stack(buf, true)])
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestInteractshCloseStopsPolling(t *testing.T) {
+	srv, calls := newFakeInteractsh(t)
+	base := runtime.NumGoroutine()
+
+	oob, err := NewOOBAdapter(InteractshName, &ConnectorParams{Domain: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// let the poller run once
+	deadline := time.Now().Add(5 * time.Second)
+	for calls("/poll") == 0 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if calls("/poll") == 0 {
+		t.Fatal("interactsh was never polled")
+	}
+
+	if err := oob.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := oob.Close(); err != nil {
+		t.Fatalf("second close: %v", err)
+	}
+	if calls("/deregister") != 1 {
+		t.Errorf("deregister calls: %d", calls("/deregister"))
+	}
+	if oob.IsVaild() {
+		t.Error("adapter still valid after close")
+	}
+	checkGoroutines(t, base)
+}
+
+func TestAdapterCloseReleasesConnections(t *testing.T) {
+	f := newFakeXray(t)
+	base := runtime.NumGoroutine()
+
+	oob, err := NewOOBAdapter(XrayName, &ConnectorParams{
+		Key:       "token",
+		Domain:    "dnslog.test",
+		ApiUrl:    f.URL,
+		RateLimit: 100, // an adapter-owned http client
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := oob.GetValidationDomain()
+	oob.ValidateResult(d.Params(OOBHTTP))
+
+	if err := oob.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if oob.IsVaild() {
+		t.Error("adapter still valid after close")
+	}
+	checkGoroutines(t, base)
+}
+
+// TestCloseConcurrent is meant for go test -race.
+func TestCloseConcurrent(t *testing.T) {
+	f := newFakeXray(t)
+	oob := newTestXrayAdapter(t, f, nil)
+	d := oob.GetValidationDomain()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			oob.IsVaild()
+			oob.ValidateResult(d.Params(OOBDNS))
+		}()
+		go func() {
+			defer wg.Done()
+			_ = oob.Close()
+		}()
+	}
+	wg.Wait()
+	if oob.IsVaild() {
+		t.Error("adapter still valid after close")
+	}
+}
+
+func TestNewOOBAdapterFailureReleases(t *testing.T) {
+	// a reachable api that issues no alphalog key
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{}`)
+	}))
+	defer srv.Close()
+	base := runtime.NumGoroutine()
+
+	params := &ConnectorParams{
+		Domain:          "alphalog.test",
+		ApiUrl:          srv.URL,
+		RateLimit:       100, // an adapter-owned http client
+		CorrelationFile: t.TempDir() + "/correlations.jsonl",
+	}
+	if _, err := NewOOBAdapter(AlphalogName, params); err == nil {
+		t.Fatal("adapter created without a key")
+	}
+	// the keep-alive connection of the failed request is closed
+	checkGoroutines(t, base)
+
+	if _, err := NewOOBAdapter("unknown", &ConnectorParams{Domain: "dnslog.test", RateLimit: 100}); err == nil {
+		t.Fatal("unknown dnslog type")
+	}
+	checkGoroutines(t, base)
+}
@@ -0,0 +1,175 @@
+package oobadapter
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// CheckMeta describes the check that produced a validation domain.
+type CheckMeta struct {
+	Target    string            `json:"target,omitempty"`    // 目标，比如：http://127.0.0.1:8080
+	Template  string            `json:"template,omitempty"`  // 模板或插件名，比如：log4j-rce
+	Parameter string            `json:"parameter,omitempty"` // 注入参数，比如：username
+	Extra     map[string]string `json:"extra,omitempty"`
+}
+
+// Correlation maps a correlation id, the random token of a filter, back to its check.
+type Correlation struct {
+	ID      string            `json:"id"`
+	Meta    CheckMeta         `json:"meta"`
+	Domains ValidationDomains `json:"domains"`
+}
+
+// LateHit is an interaction correlated with the check that issued its domain.
+type LateHit struct {
+	Correlation Correlation
+	Interaction Interaction
+}
+
+// CorrelationStore keeps correlations in memory and, when created with a file,
+// appends them as json lines so they survive restarts.
+type CorrelationStore struct {
+	mu       sync.RWMutex
+	items    map[string]Correlation
+	filename string
+}
+
+// NewCorrelationStore loads filename if it exists, an empty filename keeps the store in memory only.
+func NewCorrelationStore(filename string) (*CorrelationStore, error) {
+	s := &CorrelationStore{
+		items:    make(map[string]Correlation),
+		filename: filename,
+	}
+	if filename == "" {
+		return s, nil
+	}
+	f, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		c := Correlation{}
+		if err := json.Unmarshal([]byte(line), &c); err != nil {
+			return nil, fmt.Errorf("%s: %w", filename, err)
+		}
+		s.items[c.ID] = c
+	}
+	return s, scanner.Err()
+}
+
+// Put records c, and persists it when the store has a file.
+func (s *CorrelationStore) Put(c Correlation) error {
+	c.ID = strings.ToLower(c.ID)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items[c.ID] = c
+	if s.filename == "" {
+		return nil
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// Close drops the correlations held in memory, the file is kept for a later store.
+func (s *CorrelationStore) Close() error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items = make(map[string]Correlation)
+	return nil
+}
+
+func (s *CorrelationStore) Get(id string) (Correlation, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	c, ok := s.items[strings.ToLower(id)]
+	return c, ok
+}
+
+// Lookup returns the correlation whose id is a label of the query name or a segment of the path.
+func (s *CorrelationStore) Lookup(it Interaction) (Correlation, bool) {
+	parts := strings.Split(it.QName, ".")
+	path, _, _ := strings.Cut(it.Path, "?")
+	parts = append(parts, strings.Split(path, "/")...)
+	for _, p := range parts {
+		if p == "" {
+			continue
+		}
+		if c, ok := s.Get(p); ok {
+			return c, true
+		}
+	}
+	return Correlation{}, false
+}
+
+// FilterToken is the random token of a filter, its first label or path segment, lowercased.
+func FilterToken(filter string) string {
+	id := strings.FieldsFunc(filter, func(r rune) bool { return r == '.' || r == '/' })
+	if len(id) == 0 {
+		return ""
+	}
+	return strings.ToLower(id[0])
+}
+
+// GetValidationDomainFor returns a validation domain whose filter token is recorded
+// against meta, so late hits can be traced back to the check with Correlate.
+func (o *OOBAdapter) GetValidationDomainFor(meta CheckMeta) (ValidationDomains, error) {
+	d := o.GetValidationDomain()
+	id := FilterToken(d.Filter)
+	if id == "" {
+		return d, fmt.Errorf("get validation domain failed")
+	}
+	if o.Correlations == nil {
+		return d, fmt.Errorf("correlation store is nil")
+	}
+	return d, o.Correlations.Put(Correlation{ID: id, Meta: meta, Domains: d})
+}
+
+// Correlate returns the check that issued the domain it hit.
+func (o *OOBAdapter) Correlate(it Interaction) (Correlation, bool) {
+	if o == nil || o.Correlations == nil {
+		return Correlation{}, false
+	}
+	return o.Correlations.Lookup(it)
+}
+
+// LateHits polls every record of filterType and returns those that belong to a recorded check.
+func (o *OOBAdapter) LateHits(filterType string) ([]LateHit, error) {
+	body, err := o.Poll(filterType)
+	if err != nil || len(body) == 0 {
+		return nil, err
+	}
+	out := make([]LateHit, 0)
+	for _, it := range NormalizeRecords(o.DnsLogType, body) {
+		if c, ok := o.Correlate(it); ok {
+			out = append(out, LateHit{Correlation: c, Interaction: it})
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,109 @@
+package oobadapter
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCorrelationLateHits(t *testing.T) {
+	f := newFakeXray(t)
+	file := filepath.Join(t.TempDir(), "correlations.jsonl")
+
+	first := newTestXrayAdapter(t, f, &ConnectorParams{CorrelationFile: file})
+	dnsMeta := CheckMeta{Target: "http://10.0.0.1:8080", Template: "log4j-rce", Parameter: "username"}
+	dnsDomain, err := first.GetValidationDomainFor(dnsMeta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpMeta := CheckMeta{Target: "http://10.0.0.2", Template: "ssrf", Extra: map[string]string{"method": "POST"}}
+	httpDomain, err := first.GetValidationDomainFor(httpMeta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unrecorded := first.GetValidationDomain()
+	first.Close()
+
+	// one json line per correlation
+	fh, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fh.Close()
+	var lines []Correlation
+	scanner := bufio.NewScanner(fh)
+	for scanner.Scan() {
+		c := Correlation{}
+		if err := json.Unmarshal(scanner.Bytes(), &c); err != nil {
+			t.Fatalf("line %q: %v", scanner.Text(), err)
+		}
+		lines = append(lines, c)
+	}
+	if len(lines) != 2 || lines[0].ID != FilterToken(dnsDomain.Filter) || lines[1].Meta.Template != "ssrf" {
+		t.Fatalf("correlation file: %+v", lines)
+	}
+
+	// the hits arrive after the scan ended
+	f.dnsHit(strings.ToUpper(dnsDomain.DNS))
+	f.dnsHit(unrecorded.DNS)
+	resp, err := http.Get(httpDomain.HTTP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	// a later process reloads the store
+	second := newTestXrayAdapter(t, f, &ConnectorParams{CorrelationFile: file})
+	hits, err := second.LateHits(OOBDNS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 1 {
+		t.Fatalf("dns late hits: %+v", hits)
+	}
+	if c := hits[0].Correlation; c.Meta.Target != dnsMeta.Target || c.Meta.Parameter != "username" || c.Domains.DNS != dnsDomain.DNS {
+		t.Errorf("dns late hit: %+v", c)
+	}
+	hits, err = second.LateHits(OOBHTTP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 1 || hits[0].Correlation.Meta.Extra["method"] != "POST" || hits[0].Interaction.Protocol != OOBHTTP {
+		t.Fatalf("http late hits: %+v", hits)
+	}
+
+	if _, ok := second.Correlate(Interaction{Protocol: OOBDNS, QName: unrecorded.DNS}); ok {
+		t.Error("unrecorded domain correlated")
+	}
+	if c, ok := second.Correlate(Interaction{Protocol: OOBDNS, QName: "x." + strings.ToUpper(dnsDomain.DNS)}); !ok || c.Meta.Template != "log4j-rce" {
+		t.Errorf("correlate: %+v %v", c, ok)
+	}
+}
+
+func TestCorrelationStoreMemory(t *testing.T) {
+	s, err := NewCorrelationStore("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put(Correlation{ID: "AbC123", Meta: CheckMeta{Template: "t"}}); err != nil {
+		t.Fatal(err)
+	}
+	if c, ok := s.Get("abc123"); !ok || c.Meta.Template != "t" {
+		t.Errorf("get: %+v %v", c, ok)
+	}
+	if _, ok := s.Lookup(Interaction{Path: "/p/abc123?x=1"}); !ok {
+		t.Error("lookup by path segment")
+	}
+
+	broken := filepath.Join(t.TempDir(), "broken.jsonl")
+	if err := os.WriteFile(broken, []byte("{\"id\":\"a\"}\nnot json\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewCorrelationStore(broken); err == nil {
+		t.Error("broken file loaded")
+	}
+}
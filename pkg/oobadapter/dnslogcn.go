@@ -2,8 +2,10 @@ package oobadapter
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
-	"strings"
+	"sync"
 	"time"
 
 	"github.com/zan8in/oobadapter/pkg/retryhttp"
@@ -24,10 +26,19 @@ type DnslogcnConnector struct {
 	DnslogcnFilter string // match url name rule, the filter max length is 20.
 	Cookie         string
 	IsAlive        bool
+	mu             sync.Mutex // guards IsAlive and Cookie
+	signer         *filterSigner
+	http           *retryhttp.HTTPClient
+	fetches        *recordCache
+	issued         *issueLog
 }
 
 func NewDnslogcnConnector(params *ConnectorParams) (*DnslogcnConnector, error) {
-	status, cookie, body := retryhttp.GetWithCookie(fmt.Sprintf("http://dnslog.cn/getdomain.php?t=0.%d", time.Now().UnixNano()))
+	client, err := params.httpClient()
+	if err != nil {
+		return nil, err
+	}
+	status, cookie, body := client.GetWithCookie(fmt.Sprintf("http://dnslog.cn/getdomain.php?t=0.%d", time.Now().UnixNano()))
 
 	if status != 0 && bytes.Contains(body, []byte("."+params.Domain)) {
 		return &DnslogcnConnector{
@@ -35,23 +46,33 @@ func NewDnslogcnConnector(params *ConnectorParams) (*DnslogcnConnector, error) {
 			DnslogcnFilter: string(bytes.TrimSpace(body)),
 			Cookie:         cookie,
 			IsAlive:        true,
+			signer:         newFilterSigner(params.SignKey),
+			http:           client,
+			fetches:        newRecordCache(params.RecordCacheTTL),
+			issued:         params.issueLog(),
 		}, nil
 	}
 	return nil, fmt.Errorf("new dnslogcnconnector failed")
 }
 
 func (c *DnslogcnConnector) GetValidationDomain() ValidationDomains {
-	filter := fmt.Sprintf("%s.%s", randutil.Randcase(DnslogcnSubLength), c.DnslogcnFilter)
+	filter := fmt.Sprintf("%s.%s", c.signer.token(randutil.Randcase(DnslogcnSubLength)), c.DnslogcnFilter)
 	validationDomain := ValidationDomains{
-		HTTP:   fmt.Sprintf("http://%s", filter),
-		DNS:    filter,
-		JNDI:   filter,
-		Filter: filter,
+		HTTP:     fmt.Sprintf("http://%s", filter),
+		DNS:      filter,
+		JNDI:     filter,
+		Filter:   filter,
+		IssuedAt: time.Now(),
 	}
+	c.issued.add(validationDomain)
 	return validationDomain
 }
 
 func (c *DnslogcnConnector) ValidateResult(params ValidateParams) Result {
+	params = c.issued.withIssuedAt(params)
+	if !c.signer.verifyFilter(params.Filter) {
+		return invalidSignature(DnslogcnName, params)
+	}
 	switch c.GetFilterType(params.FilterType) {
 	case DnslogcnDNS:
 		return c.validate(params)
@@ -69,9 +90,13 @@ func (c *DnslogcnConnector) ValidateResult(params ValidateParams) Result {
 
 func (c *DnslogcnConnector) validate(params ValidateParams) Result {
 	url := fmt.Sprintf("http://dnslog.cn/getrecords.php?t=0.%d", time.Now().UnixNano())
-	status, body := retryhttp.GetByCookie(url, c.Cookie)
+	// the url changes on every call to defeat caches, key on the session instead
+	cookie := c.cookie()
+	status, body := c.fetches.fetch(cookie, func() (int, []byte) {
+		return c.http.GetByCookie(url, cookie)
+	})
 	if status != 0 {
-		if strings.Contains(strings.ToLower(string(body)), strings.ToLower(params.Filter)) {
+		if matchBody(DnslogcnName, body, params.matcher(c.matcher(params))) {
 			return Result{
 				IsVaild:    true,
 				DnslogType: DnslogcnName,
@@ -85,9 +110,14 @@ func (c *DnslogcnConnector) validate(params ValidateParams) Result {
 		DnslogType: DnslogcnName,
 		FilterType: params.FilterType,
 		Body:       string(body),
+		Err:        requestError(DnslogcnName, status),
 	}
 }
 
+func (c *DnslogcnConnector) matcher(params ValidateParams) Matcher {
+	return Matcher{Filter: params.Filter}
+}
+
 func (c *DnslogcnConnector) GetFilterType(t string) string {
 	switch t {
 	case OOBHTTP:
@@ -101,7 +131,55 @@ func (c *DnslogcnConnector) GetFilterType(t string) string {
 
 func (c *DnslogcnConnector) IsVaild() bool {
 	if c != nil {
+		c.mu.Lock()
+		defer c.mu.Unlock()
 		return c.IsAlive
 	}
 	return false
 }
+
+// cookie returns the session cookie, empty once closed.
+func (c *DnslogcnConnector) cookie() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.Cookie
+}
+
+// Close abandons the dnslog.cn session, which has no api to release it, and drops the
+// cached records and the idle connections.
+func (c *DnslogcnConnector) Close() error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	if !c.IsAlive {
+		c.mu.Unlock()
+		return nil
+	}
+	c.IsAlive = false
+	c.Cookie = ""
+	c.mu.Unlock()
+	c.fetches.reset()
+	c.http.CloseIdleConnections()
+	return nil
+}
+
+// health checks the records api, an expired session no longer returns a json list.
+func (c *DnslogcnConnector) health(ctx context.Context) (HealthStep, HealthStep) {
+	api, resp := apiStep(ctx, c.http, retryhttp.Request{
+		URL:    fmt.Sprintf("http://dnslog.cn/getrecords.php?t=0.%d", time.Now().UnixNano()),
+		Header: map[string]string{"Cookie": c.cookie()},
+	})
+	if resp == nil {
+		return api, credentialStep(nil, false, "")
+	}
+	var rows []any
+	if err := json.Unmarshal(bytes.TrimSpace(resp.Body), &rows); err != nil {
+		return api, credentialStep(resp, false, "session expired")
+	}
+	return api, credentialStep(resp, true, "session valid")
+}
+
+func (c *DnslogcnConnector) delegation() (string, []string) {
+	return c.Domain, nil
+}
@@ -0,0 +1,167 @@
+package oobadapter
+
+import (
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ExfilEncoding is how exfiltrated bytes are written into dns labels.
+type ExfilEncoding string
+
+var (
+	ExfilBase32 ExfilEncoding = "base32" // lowercase, no padding
+	ExfilHex    ExfilEncoding = "hex"
+
+	MaxLabelLength = 63
+	MaxNameLength  = 253
+
+	ErrExfilIncomplete = errors.New("exfiltrated data is incomplete")
+)
+
+var exfilBase32 = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+func (e ExfilEncoding) encode(data []byte) (string, error) {
+	switch e {
+	case ExfilBase32, "":
+		return exfilBase32.EncodeToString(data), nil
+	case ExfilHex:
+		return hex.EncodeToString(data), nil
+	default:
+		return "", fmt.Errorf("unknown exfil encoding: %s", e)
+	}
+}
+
+func (e ExfilEncoding) decode(s string) ([]byte, error) {
+	s = strings.ToLower(s)
+	switch e {
+	case ExfilBase32, "":
+		return exfilBase32.DecodeString(s)
+	case ExfilHex:
+		return hex.DecodeString(s)
+	default:
+		return nil, fmt.Errorf("unknown exfil encoding: %s", e)
+	}
+}
+
+// ExfilDomains encodes data into domains of the form <data>[.<data>...].<seq>.<base>, where
+// base is a validation domain (ValidationDomains.DNS), labels are at most 63 chars and
+// names at most 253 chars. The sequence number starts at 0.
+func ExfilDomains(base string, data []byte, enc ExfilEncoding) ([]string, error) {
+	base = strings.TrimSuffix(strings.TrimSpace(base), ".")
+	if base == "" {
+		return nil, fmt.Errorf("exfil base domain is empty")
+	}
+	encoded, err := enc.encode(data)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]string, 0)
+	for seq := 0; len(encoded) > 0; seq++ {
+		suffix := "." + strconv.Itoa(seq) + "." + base
+		room := MaxNameLength - len(suffix)
+		if room < 2 {
+			return nil, fmt.Errorf("exfil base domain is too long: %s", base)
+		}
+		labels := make([]string, 0, 4)
+		for len(encoded) > 0 && room > 1 {
+			n := min(MaxLabelLength, room-1, len(encoded))
+			if len(labels) == 0 {
+				n = min(MaxLabelLength, room, len(encoded))
+			}
+			labels = append(labels, encoded[:n])
+			encoded = encoded[n:]
+			room -= n + 1
+		}
+		out = append(out, strings.Join(labels, ".")+suffix)
+	}
+	return out, nil
+}
+
+// exfilAnchor is the part of base that every provider reports back in the query name,
+// its first two labels, e.g. filterxxx.yyy of filterxxx.yyy.ceye.io.
+func exfilAnchor(base string) string {
+	labels := strings.Split(normalizeQName(base), ".")
+	if len(labels) >= 3 {
+		return strings.Join(labels[:2], ".")
+	}
+	return strings.Join(labels, ".")
+}
+
+// ReassembleExfil collects the dns interactions carrying chunks under base and returns the
+// decoded data. Duplicate chunks from resolver retries are ignored; when a sequence number
+// is missing the data before the gap is returned with ErrExfilIncomplete.
+func ReassembleExfil(base string, items []Interaction, enc ExfilEncoding) ([]byte, error) {
+	anchor := "." + exfilAnchor(base) + "."
+	if anchor == ".." {
+		return nil, fmt.Errorf("exfil base domain is empty")
+	}
+
+	chunks := make(map[int]string)
+	for _, it := range items {
+		if it.Protocol != "" && it.Protocol != OOBDNS {
+			continue
+		}
+		qname := "." + normalizeQName(it.QName) + "."
+		i := strings.Index(qname, anchor)
+		if i <= 0 {
+			continue
+		}
+		labels := strings.Split(strings.Trim(qname[:i], "."), ".")
+		if len(labels) < 2 {
+			continue
+		}
+		seq, err := strconv.Atoi(labels[len(labels)-1])
+		if err != nil || seq < 0 {
+			continue
+		}
+		chunks[seq] = strings.Join(labels[:len(labels)-1], "")
+	}
+	if len(chunks) == 0 {
+		return nil, ErrExfilIncomplete
+	}
+
+	seqs := make([]int, 0, len(chunks))
+	for seq := range chunks {
+		seqs = append(seqs, seq)
+	}
+	sort.Ints(seqs)
+
+	var b strings.Builder
+	var incomplete error
+	for i, seq := range seqs {
+		if seq != i {
+			incomplete = ErrExfilIncomplete
+			break
+		}
+		b.WriteString(chunks[seq])
+	}
+	encoded := b.String()
+	if enc == ExfilBase32 || enc == "" {
+		// a truncated base32 tail cannot be decoded, drop it
+		if r := len(encoded) % 8; r == 1 || r == 3 || r == 6 {
+			encoded = encoded[:len(encoded)-1]
+		}
+	} else if len(encoded)%2 == 1 {
+		encoded = encoded[:len(encoded)-1]
+	}
+	data, err := enc.decode(encoded)
+	if err != nil {
+		return nil, err
+	}
+	return data, incomplete
+}
+
+// Exfiltrated polls the dns records of the adapter and reassembles the data sent under d.
+func (o *OOBAdapter) Exfiltrated(d ValidationDomains, enc ExfilEncoding) ([]byte, error) {
+	body, err := o.Poll(OOBDNS)
+	if err != nil {
+		return nil, err
+	}
+	return ReassembleExfil(d.DNS, NormalizeRecords(o.DnsLogType, body), enc)
+}
@@ -0,0 +1,87 @@
+package oobadapter
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func exfilInteractions(domains []string) []Interaction {
+	out := make([]Interaction, 0, len(domains))
+	for _, d := range domains {
+		out = append(out, Interaction{Protocol: OOBDNS, QName: d})
+	}
+	return out
+}
+
+func TestExfilRoundTrip(t *testing.T) {
+	base := "abc12345.dnslog.test"
+	data := bytes.Repeat([]byte("root:x:0:0:root:/root:/bin/bash\n"), 40)
+	for _, enc := range []ExfilEncoding{ExfilBase32, ExfilHex} {
+		domains, err := ExfilDomains(base, data, enc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(domains) < 2 {
+			t.Fatalf("%s: %d domains", enc, len(domains))
+		}
+		for _, d := range domains {
+			if len(d) > MaxNameLength || !strings.HasSuffix(d, "."+base) {
+				t.Errorf("%s: bad name %s", enc, d)
+			}
+			for _, label := range strings.Split(d, ".") {
+				if len(label) == 0 || len(label) > MaxLabelLength {
+					t.Errorf("%s: bad label %q", enc, label)
+				}
+			}
+		}
+
+		// resolvers retry, upper-case and reorder queries
+		items := exfilInteractions(domains)
+		items = append(items, exfilInteractions(domains[:1])...)
+		items[0].QName = strings.ToUpper(items[0].QName)
+		items[0], items[len(items)-2] = items[len(items)-2], items[0]
+		items = append(items, Interaction{Protocol: OOBHTTP, QName: "zz.0." + base})
+		got, err := ReassembleExfil(base, items, enc)
+		if err != nil {
+			t.Fatalf("%s: %v", enc, err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("%s: data mismatch", enc)
+		}
+	}
+}
+
+func TestExfilGap(t *testing.T) {
+	base := "abc12345.dnslog.test"
+	data := bytes.Repeat([]byte("0123456789"), 60)
+	domains, err := ExfilDomains(base, data, ExfilBase32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(domains) < 3 {
+		t.Fatalf("%d domains", len(domains))
+	}
+
+	// the data before the missing chunk is returned
+	items := exfilInteractions(append(domains[:1:1], domains[2:]...))
+	got, err := ReassembleExfil(base, items, ExfilBase32)
+	if !errors.Is(err, ErrExfilIncomplete) {
+		t.Fatalf("err: %v", err)
+	}
+	if len(got) == 0 || len(got) >= len(data) || !bytes.HasPrefix(data, got) {
+		t.Errorf("got %d bytes, not a prefix of the data", len(got))
+	}
+
+	// the first chunk missing leaves nothing
+	if got, err := ReassembleExfil(base, exfilInteractions(domains[1:]), ExfilBase32); !errors.Is(err, ErrExfilIncomplete) || len(got) != 0 {
+		t.Errorf("first chunk missing: %d bytes, %v", len(got), err)
+	}
+	if _, err := ReassembleExfil(base, nil, ExfilBase32); !errors.Is(err, ErrExfilIncomplete) {
+		t.Errorf("no records: %v", err)
+	}
+	if _, err := ExfilDomains(strings.Repeat("a.", 126)+"test", data, ExfilHex); err == nil {
+		t.Error("base domain too long accepted")
+	}
+}
@@ -0,0 +1,252 @@
+package oobadapter
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// placeholderRegexp matches the nuclei style placeholders, e.g. {{interactsh-url}}, {{oob-dns}}.
+var placeholderRegexp = regexp.MustCompile(`(?i)\{\{\s*(interactsh-url|oob-dns|oob-http|oob-ldap|oob-rmi|oob-filter)\s*\}\}`)
+
+// Expansion is a template whose placeholders were replaced with one validation domain.
+type Expansion struct {
+	Text      string
+	Domains   ValidationDomains
+	Protocols []string // 需要拉取记录的协议，由模板中出现的占位符决定
+
+	adapter *OOBAdapter
+}
+
+// ExpansionMatcher is a nuclei style matcher evaluated against each interaction.
+type ExpansionMatcher struct {
+	Part      string   // 匹配位置：interactsh_protocol, interactsh_request, interactsh_ip
+	Type      string   // 匹配类型：word, regex，默认 word
+	Words     []string // 关键字，不区分大小写
+	Regex     []string // 正则
+	Condition string   // 多个关键字或正则之间的关系：and, or，默认 or
+	Negative  bool     // 取反
+}
+
+// Expand allocates a validation domain and substitutes every placeholder of text:
+//
+//	{{interactsh-url}}, {{oob-dns}}  the dns domain
+//	{{oob-http}}                     the http url
+//	{{oob-ldap}}, {{oob-rmi}}        the ldap/rmi url, or one resolving the dns domain when the provider has none
+//	{{oob-filter}}                   the filter
+//
+// All placeholders share the same domain.
+func (o *OOBAdapter) Expand(text string) (*Expansion, error) {
+	if o == nil {
+		return nil, fmt.Errorf("oob adapter is nil")
+	}
+	d := o.GetValidationDomain()
+	if d.Filter == "" {
+		return nil, fmt.Errorf("get validation domain failed")
+	}
+
+	e := &Expansion{Domains: d, adapter: o}
+	protocols := make(map[string]bool)
+	var err error
+	e.Text = placeholderRegexp.ReplaceAllStringFunc(text, func(s string) string {
+		name := strings.ToLower(placeholderRegexp.FindStringSubmatch(s)[1])
+		switch name {
+		case "interactsh-url":
+			protocols[OOBDNS], protocols[OOBHTTP] = true, true
+			return d.DNS
+		case "oob-dns":
+			protocols[OOBDNS] = true
+			return d.DNS
+		case "oob-http":
+			protocols[OOBHTTP] = true
+			if d.HTTP == "" {
+				err = fmt.Errorf("%s has no http url", o.DnsLogType)
+			}
+			return d.HTTP
+		case "oob-ldap":
+			if d.LDAP != "" {
+				protocols[OOBLDAP] = true
+				return d.LDAP
+			}
+			protocols[OOBDNS] = true
+			return "ldap://" + d.DNS + "/a"
+		case "oob-rmi":
+			if d.RMI != "" {
+				protocols[OOBRMI] = true
+				return d.RMI
+			}
+			protocols[OOBDNS] = true
+			return "rmi://" + d.DNS + "/a"
+		default:
+			return d.Filter
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(protocols) == 0 {
+		protocols[OOBDNS] = true
+	}
+	for _, p := range []string{OOBDNS, OOBHTTP, OOBLDAP, OOBRMI} {
+		if protocols[p] {
+			e.Protocols = append(e.Protocols, p)
+		}
+	}
+	return e, nil
+}
+
+// Interactions polls the records of every protocol of the expansion and returns the
+// interactions that hit its domain since it was issued.
+func (e *Expansion) Interactions() ([]Interaction, error) {
+	o := e.adapter
+	m, _ := o.withDefaults(ValidateParams{IssuedAt: e.Domains.IssuedAt}).conditions()
+	m.Filter = FilterToken(e.Domains.Filter)
+
+	out := make([]Interaction, 0)
+	seen := make(map[string]bool)
+	for _, p := range e.Protocols {
+		body, err := o.Poll(p)
+		if err != nil {
+			return out, err
+		}
+		if len(body) == 0 {
+			continue
+		}
+		for _, it := range m.Select(NormalizeRecords(o.DnsLogType, body)) {
+			if it.Raw != "" && seen[it.Raw] {
+				continue
+			}
+			seen[it.Raw] = true
+			out = append(out, it)
+		}
+	}
+	return out, nil
+}
+
+// Validate reports whether any interaction satisfies the matchers, combined with condition
+// (and, or; default or), and returns the interactions that did. Without matchers any
+// interaction matches.
+func (e *Expansion) Validate(condition string, matchers ...ExpansionMatcher) (bool, []Interaction, error) {
+	items, err := e.Interactions()
+	if err != nil {
+		return false, nil, err
+	}
+	hits := make([]Interaction, 0)
+	for _, it := range items {
+		ok, err := matchExpansion(it, condition, matchers)
+		if err != nil {
+			return false, nil, err
+		}
+		if ok {
+			hits = append(hits, it)
+		}
+	}
+	return len(hits) > 0, hits, nil
+}
+
+func matchExpansion(it Interaction, condition string, matchers []ExpansionMatcher) (bool, error) {
+	and := strings.EqualFold(condition, "and")
+	for i, m := range matchers {
+		ok, err := m.match(it)
+		if err != nil {
+			return false, err
+		}
+		if and && !ok {
+			return false, nil
+		}
+		if !and && ok {
+			return true, nil
+		}
+		if !and && i == len(matchers)-1 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (m ExpansionMatcher) match(it Interaction) (bool, error) {
+	var part string
+	isProtocol := false
+	switch strings.ToLower(m.Part) {
+	case "interactsh_protocol", "oob_protocol":
+		part, isProtocol = it.Protocol, true
+	case "interactsh_request", "oob_request", "":
+		part = requestText(it)
+	case "interactsh_ip", "oob_ip":
+		part = it.RemoteAddr
+	default:
+		return false, fmt.Errorf("unknown matcher part: %s", m.Part)
+	}
+
+	and := strings.EqualFold(m.Condition, "and")
+	matched := and
+	switch strings.ToLower(m.Type) {
+	case "word", "words", "":
+		lower := strings.ToLower(part)
+		for _, w := range m.Words {
+			ok := strings.Contains(lower, strings.ToLower(w))
+			if isProtocol {
+				ok = normalizeProtocol(w) == normalizeProtocol(part)
+			}
+			if and && !ok {
+				matched = false
+				break
+			}
+			if !and && ok {
+				matched = true
+				break
+			}
+		}
+	case "regex":
+		for _, expr := range m.Regex {
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				return false, err
+			}
+			ok := re.MatchString(part)
+			if and && !ok {
+				matched = false
+				break
+			}
+			if !and && ok {
+				matched = true
+				break
+			}
+		}
+	default:
+		return false, fmt.Errorf("unknown matcher type: %s", m.Type)
+	}
+	return matched != m.Negative, nil
+}
+
+// requestText is the raw request of it as nuclei sees it: the request kept by the provider,
+// or one rebuilt from its fields. The provider's record is only used when there is nothing else.
+func requestText(it Interaction) string {
+	if it.Request != "" {
+		return it.Request
+	}
+	if it.Method != "" {
+		var b strings.Builder
+		b.WriteString(it.Method + " " + it.Path + " HTTP/1.1\r\n")
+		if it.QName != "" && it.Header.Get("Host") == "" {
+			b.WriteString("Host: " + it.QName + "\r\n")
+		}
+		keys := make([]string, 0, len(it.Header))
+		for k := range it.Header {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			for _, v := range it.Header[k] {
+				b.WriteString(k + ": " + v + "\r\n")
+			}
+		}
+		b.WriteString("\r\n" + it.Body)
+		return b.String()
+	}
+	if it.QName != "" {
+		return strings.TrimSpace(it.QType + " " + it.QName)
+	}
+	return it.Raw
+}
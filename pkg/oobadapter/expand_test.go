@@ -0,0 +1,149 @@
+package oobadapter
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/projectdiscovery/interactsh/pkg/server"
+)
+
+func TestExpandPlaceholders(t *testing.T) {
+	f := newFakeXray(t)
+	oob := newTestXrayAdapter(t, f, nil)
+
+	cases := []struct {
+		text      string
+		want      func(d ValidationDomains) string
+		protocols string
+	}{
+		{"curl {{interactsh-url}}", func(d ValidationDomains) string { return "curl " + d.DNS }, "[dns http]"},
+		{"{{ OOB-DNS }}/{{oob-filter}}", func(d ValidationDomains) string { return d.DNS + "/" + d.Filter }, "[dns]"},
+		{"wget {{oob-http}}", func(d ValidationDomains) string { return "wget " + d.HTTP }, "[http]"},
+		// xray has no ldap or rmi server, a url resolving the dns domain stands in
+		{"${jndi:{{oob-ldap}}} {{oob-rmi}}", func(d ValidationDomains) string { return "${jndi:ldap://" + d.DNS + "/a} rmi://" + d.DNS + "/a" }, "[dns]"},
+		{"{{oob-http}} {{oob-dns}}", func(d ValidationDomains) string { return d.HTTP + " " + d.DNS }, "[dns http]"},
+		{"no placeholder {{unknown}}", func(d ValidationDomains) string { return "no placeholder {{unknown}}" }, "[dns]"},
+	}
+	for _, c := range cases {
+		e, err := oob.Expand(c.text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := c.want(e.Domains); e.Text != want {
+			t.Errorf("%s: got %q, want %q", c.text, e.Text, want)
+		}
+		if got := fmt.Sprint(e.Protocols); got != c.protocols {
+			t.Errorf("%s: protocols %s, want %s", c.text, got, c.protocols)
+		}
+	}
+}
+
+func TestExpandValidate(t *testing.T) {
+	f := newFakeXray(t)
+	oob := newTestXrayAdapter(t, f, &ConnectorParams{RecordCacheTTL: -1})
+
+	e, err := oob.Expand("curl {{oob-http}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := oob.Expand("curl {{oob-http}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, _, err := e.Validate(""); ok || err != nil {
+		t.Fatalf("before the hit: %v %v", ok, err)
+	}
+	resp, err := http.Get(e.Domains.HTTP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	ok, hits, err := e.Validate("and",
+		ExpansionMatcher{Part: "interactsh_protocol", Words: []string{"http"}},
+		ExpansionMatcher{Part: "interactsh_request", Type: "regex", Regex: []string{`^GET /p/\S+ HTTP/1\.1\r\n`}},
+	)
+	if !ok || len(hits) != 1 || err != nil {
+		t.Fatalf("hit: %v %d %v", ok, len(hits), err)
+	}
+	// the hit of another expansion does not count
+	if ok, _, _ := other.Validate(""); ok {
+		t.Error("other expansion matched")
+	}
+}
+
+func TestExpansionMatcher(t *testing.T) {
+	it := normalizeInteractsh(server.Interaction{
+		Protocol:      "http",
+		FullId:        "abc.oast.test",
+		RemoteAddress: "10.1.2.3:4567",
+		RawRequest:    "GET /x?q=1 HTTP/1.1\r\nHost: abc.oast.test\r\nUser-Agent: curl/8.0\r\n\r\n",
+		Timestamp:     time.Now(),
+	})
+	dns := Interaction{Protocol: OOBDNS, QName: "abc.oast.test", QType: "A", Raw: `{"q-type":"A"}`}
+
+	cases := []struct {
+		name      string
+		it        Interaction
+		condition string
+		matchers  []ExpansionMatcher
+		want      bool
+	}{
+		{"no matchers", it, "", nil, true},
+		{"protocol", it, "", []ExpansionMatcher{{Part: "interactsh_protocol", Words: []string{"HTTPS"}}}, true},
+		{"protocol is not a substring", it, "", []ExpansionMatcher{{Part: "interactsh_protocol", Words: []string{"htt"}}}, false},
+		{"request regex on the raw request", it, "", []ExpansionMatcher{{Part: "interactsh_request", Type: "regex", Regex: []string{`(?m)^User-Agent: curl/.*\r$`}}}, true},
+		{"request words or", it, "", []ExpansionMatcher{{Words: []string{"wget", "CURL"}}}, true},
+		{"request words and", it, "", []ExpansionMatcher{{Words: []string{"wget", "curl"}, Condition: "and"}}, false},
+		{"negative", it, "", []ExpansionMatcher{{Words: []string{"wget"}, Negative: true}}, true},
+		{"negative hit", it, "", []ExpansionMatcher{{Words: []string{"curl"}, Negative: true}}, false},
+		{"ip", it, "", []ExpansionMatcher{{Part: "interactsh_ip", Words: []string{"10.1.2.3"}}}, true},
+		{"matchers or", it, "or", []ExpansionMatcher{{Words: []string{"wget"}}, {Part: "interactsh_ip", Words: []string{"10.1.2.3"}}}, true},
+		{"matchers and", it, "and", []ExpansionMatcher{{Words: []string{"wget"}}, {Part: "interactsh_ip", Words: []string{"10.1.2.3"}}}, false},
+		{"dns request is the query", dns, "", []ExpansionMatcher{{Type: "regex", Regex: []string{`^A abc\.oast\.test$`}}}, true},
+	}
+	for _, c := range cases {
+		got, err := matchExpansion(c.it, c.condition, c.matchers)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if got != c.want {
+			t.Errorf("%s: got %v, want %v", c.name, got, c.want)
+		}
+	}
+
+	for _, m := range []ExpansionMatcher{{Part: "body"}, {Type: "dsl"}, {Type: "regex", Regex: []string{"("}}} {
+		if _, err := matchExpansion(it, "", []ExpansionMatcher{m}); err == nil {
+			t.Errorf("%+v: expected error", m)
+		}
+	}
+}
+
+func TestRequestText(t *testing.T) {
+	// rebuilt from the fields, with no json of the provider record
+	it := Interaction{
+		Method: "POST",
+		Path:   "/a",
+		QName:  "abc.oast.test",
+		Header: http.Header{"X-B": {"2"}, "User-Agent": {"curl"}},
+		Body:   "id=1",
+		Raw:    `{"method":"POST"}`,
+	}
+	want := "POST /a HTTP/1.1\r\nHost: abc.oast.test\r\nUser-Agent: curl\r\nX-B: 2\r\n\r\nid=1"
+	if got := requestText(it); got != want {
+		t.Errorf("rebuilt: %q", got)
+	}
+	it.Request = "raw"
+	if got := requestText(it); got != "raw" {
+		t.Errorf("raw request: %q", got)
+	}
+	if got := requestText(Interaction{Raw: "record"}); got != "record" {
+		t.Errorf("fallback: %q", got)
+	}
+	if strings.Contains(requestText(NormalizeRecords(XrayName, []byte(`[{"protocol":"http","method":"GET","url":"http://x.test/abc"}]`))[0]), "{") {
+		t.Error("xray record json used as the request")
+	}
+}
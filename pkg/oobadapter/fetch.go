@@ -0,0 +1,81 @@
+package oobadapter
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// DefaultRecordCacheTTL is 0, responses are not kept and a validation always sees records
+// fetched after it was issued; concurrent identical fetches are still coalesced.
+var DefaultRecordCacheTTL time.Duration
+
+// recordCache coalesces identical concurrent record fetches and, when ttl is positive, keeps
+// successful responses for ttl, so parallel validations share one upstream request.
+type recordCache struct {
+	ttl   time.Duration
+	group singleflight.Group
+	mu    sync.Mutex
+	items map[string]cachedFetch
+}
+
+type cachedFetch struct {
+	status int
+	body   []byte
+	at     time.Time
+}
+
+// newRecordCache keeps responses for ttl, 0 uses DefaultRecordCacheTTL and a ttl that is not
+// positive only coalesces concurrent fetches.
+func newRecordCache(ttl time.Duration) *recordCache {
+	if ttl == 0 {
+		ttl = DefaultRecordCacheTTL
+	}
+	return &recordCache{
+		ttl:   ttl,
+		items: make(map[string]cachedFetch),
+	}
+}
+
+// fetch returns the cached response of key, or calls fn once for all concurrent callers.
+// Failed fetches, per requestError, are not cached.
+func (c *recordCache) fetch(key string, fn func() (int, []byte)) (int, []byte) {
+	if c == nil {
+		return fn()
+	}
+	now := time.Now()
+	c.mu.Lock()
+	if it, ok := c.items[key]; ok && now.Sub(it.at) < c.ttl {
+		c.mu.Unlock()
+		return it.status, it.body
+	}
+	c.mu.Unlock()
+
+	v, _, _ := c.group.Do(key, func() (any, error) {
+		status, body := fn()
+		if c.ttl > 0 && requestError("", status) == nil {
+			c.mu.Lock()
+			for k, it := range c.items {
+				if now.Sub(it.at) >= c.ttl {
+					delete(c.items, k)
+				}
+			}
+			c.items[key] = cachedFetch{status: status, body: body, at: time.Now()}
+			c.mu.Unlock()
+		}
+		return cachedFetch{status: status, body: body}, nil
+	})
+	it := v.(cachedFetch)
+	return it.status, it.body
+}
+
+// reset drops every cached response.
+func (c *recordCache) reset() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	clear(c.items)
+	c.mu.Unlock()
+}
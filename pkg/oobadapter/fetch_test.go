@@ -0,0 +1,95 @@
+package oobadapter
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fetchConcurrently calls c.fetch n times at once and checks every caller got the records.
+func fetchConcurrently(t *testing.T, c *recordCache, url string, n int) {
+	t.Helper()
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			status, body := c.fetch(url, func() (int, []byte) {
+				resp, err := http.Get(url)
+				if err != nil {
+					return 0, nil
+				}
+				defer resp.Body.Close()
+				b, _ := io.ReadAll(resp.Body)
+				return resp.StatusCode, b
+			})
+			if status != http.StatusOK || string(body) != "records" {
+				t.Errorf("fetch: %d %q", status, body)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestRecordCacheCoalesces(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		time.Sleep(100 * time.Millisecond)
+		io.WriteString(w, "records")
+	}))
+	defer srv.Close()
+
+	const n = 20
+	c := newRecordCache(500 * time.Millisecond)
+	fetchConcurrently(t, c, srv.URL, n)
+	if got := hits.Load(); got != 1 {
+		t.Fatalf("concurrent fetches: %d requests", got)
+	}
+	// inside the ttl the response is reused
+	fetchConcurrently(t, c, srv.URL, n)
+	if got := hits.Load(); got != 1 {
+		t.Fatalf("fetches inside the ttl: %d requests", got)
+	}
+	time.Sleep(500 * time.Millisecond)
+	fetchConcurrently(t, c, srv.URL, n)
+	if got := hits.Load(); got != 2 {
+		t.Fatalf("fetches after the ttl: %d requests", got)
+	}
+
+	// a negative ttl and the default only coalesce
+	for _, ttl := range []time.Duration{-1, 0} {
+		hits.Store(0)
+		c := newRecordCache(ttl)
+		fetchConcurrently(t, c, srv.URL, n)
+		if got := hits.Load(); got != 1 {
+			t.Errorf("ttl %s: concurrent fetches: %d requests", ttl, got)
+		}
+		fetchConcurrently(t, c, srv.URL, n)
+		if got := hits.Load(); got != 2 {
+			t.Errorf("ttl %s: sequential fetches: %d requests", ttl, got)
+		}
+	}
+}
+
+func TestRecordCacheDefaultSeesNewRecords(t *testing.T) {
+	f := newFakeXray(t)
+	oob := newTestXrayAdapter(t, f, nil)
+
+	d := oob.GetValidationDomain()
+	if res := oob.ValidateResult(d.Params(OOBDNS)); res.IsVaild {
+		t.Fatal("valid before the hit")
+	}
+	// a validation right after the trigger is not answered from the previous fetch
+	f.dnsHit(d.DNS)
+	if res := oob.ValidateResult(d.Params(OOBDNS)); !res.IsVaild {
+		t.Fatal("hit missed")
+	}
+	if got := f.pollCount("dns"); got != 2 {
+		t.Errorf("dns fetches: %d", got)
+	}
+}
@@ -0,0 +1,281 @@
+package oobadapter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/zan8in/oobadapter/pkg/retryhttp"
+)
+
+type HealthStatus string
+
+var (
+	HealthOK      HealthStatus = "ok"
+	HealthFailed  HealthStatus = "failed"
+	HealthSkipped HealthStatus = "skipped"
+)
+
+var (
+	HealthStepAPI         = "api"         // api 是否可达
+	HealthStepCredentials = "credentials" // 密钥或会话是否有效
+	HealthStepDNS         = "dns"         // payload 域名的 NS 委派
+	HealthStepHTTP        = "http"        // payload http 地址是否可达
+)
+
+// HealthStep is the outcome of one check of HealthCheck.
+type HealthStep struct {
+	Name    string
+	Status  HealthStatus
+	Latency time.Duration
+	Detail  string
+}
+
+// HealthReport tells whether a provider is usable and, when it is not, which step failed.
+type HealthReport struct {
+	DnslogType string
+	Healthy    bool // 没有失败的步骤
+	Steps      []HealthStep
+	Latency    time.Duration // 所有步骤的总耗时
+}
+
+// Step returns the step called name.
+func (r HealthReport) Step(name string) (HealthStep, bool) {
+	for _, s := range r.Steps {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return HealthStep{}, false
+}
+
+// HealthCheck verifies api reachability, credentials, the NS delegation of the payload
+// zone and the reachability of the payload http url, timing each step. The http step hits
+// a fresh validation domain, which shows up as a record on the provider.
+func (o *OOBAdapter) HealthCheck(ctx context.Context) HealthReport {
+	report := HealthReport{DnslogType: o.DnsLogType}
+	api, creds := o.health(ctx)
+	report.Steps = append(report.Steps, api, creds)
+
+	zone, nameservers := o.delegation()
+	report.Steps = append(report.Steps, dnsDelegationStep(ctx, zone, nameservers))
+	d := o.GetValidationDomain()
+	var client *retryhttp.HTTPClient
+	if o.Params != nil {
+		client, _ = o.Params.httpClient()
+	}
+	report.Steps = append(report.Steps, httpListenerStep(ctx, client, d.HTTP))
+
+	report.Healthy = true
+	for _, s := range report.Steps {
+		report.Latency += s.Latency
+		if s.Status == HealthFailed {
+			report.Healthy = false
+		}
+	}
+	return report
+}
+
+// health returns the api and credentials steps of the connector.
+func (o *OOBAdapter) health(ctx context.Context) (HealthStep, HealthStep) {
+	switch o.DnsLogType {
+	case CeyeName:
+		return o.DnsLogModel.(*CeyeConnector).health(ctx)
+	case DnslogcnName:
+		return o.DnsLogModel.(*DnslogcnConnector).health(ctx)
+	case AlphalogName:
+		return o.DnsLogModel.(*AlphalogConnector).health(ctx)
+	case XrayName:
+		return o.DnsLogModel.(*XrayConnector).health(ctx)
+	case RevsuitName:
+		return o.DnsLogModel.(*RevsuitConnector).health(ctx)
+	case InteractshName:
+		return o.DnsLogModel.(*InteractshConnector).health(ctx)
+	default:
+		return HealthStep{Name: HealthStepAPI, Status: HealthFailed, Detail: "unknown dnslog type"},
+			skippedStep(HealthStepCredentials, "unknown dnslog type")
+	}
+}
+
+// delegation returns the zone the payload domains live in and, when known, the nameserver
+// it must be delegated to. ConnectorParams.Nameservers takes precedence over the connector's.
+func (o *OOBAdapter) delegation() (string, []string) {
+	zone, nameservers := o.connectorDelegation()
+	if o.Params != nil && len(o.Params.Nameservers) > 0 {
+		nameservers = o.Params.Nameservers
+	}
+	return zone, nameservers
+}
+
+// connectorDelegation returns the zone and nameservers known to the connector.
+func (o *OOBAdapter) connectorDelegation() (string, []string) {
+	switch o.DnsLogType {
+	case CeyeName:
+		return o.DnsLogModel.(*CeyeConnector).delegation()
+	case DnslogcnName:
+		return o.DnsLogModel.(*DnslogcnConnector).delegation()
+	case AlphalogName:
+		return o.DnsLogModel.(*AlphalogConnector).delegation()
+	case XrayName:
+		return o.DnsLogModel.(*XrayConnector).delegation()
+	case RevsuitName:
+		return o.DnsLogModel.(*RevsuitConnector).delegation()
+	case InteractshName:
+		return o.DnsLogModel.(*InteractshConnector).delegation()
+	default:
+		return "", nil
+	}
+}
+
+func skippedStep(name, detail string) HealthStep {
+	return HealthStep{Name: name, Status: HealthSkipped, Detail: detail}
+}
+
+// apiStep sends r and reports whether the api answered, the response is nil when it did not.
+func apiStep(ctx context.Context, client *retryhttp.HTTPClient, r retryhttp.Request) (HealthStep, *retryhttp.Response) {
+	step := HealthStep{Name: HealthStepAPI}
+	start := time.Now()
+	resp, err := client.Do(ctx, r)
+	step.Latency = time.Since(start)
+	switch {
+	case err != nil:
+		step.Status, step.Detail = HealthFailed, err.Error()
+		return step, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		step.Status, step.Detail = HealthFailed, fmt.Sprintf("status: %d", resp.StatusCode)
+		return step, nil
+	default:
+		step.Status, step.Detail = HealthOK, fmt.Sprintf("status: %d", resp.StatusCode)
+		return step, resp
+	}
+}
+
+// credentialStep reports the credential check made on the api response, skipped when the api failed.
+func credentialStep(resp *retryhttp.Response, ok bool, detail string) HealthStep {
+	if resp == nil {
+		return skippedStep(HealthStepCredentials, "api unreachable")
+	}
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return HealthStep{Name: HealthStepCredentials, Status: HealthFailed, Detail: fmt.Sprintf("status: %d", resp.StatusCode)}
+	}
+	if !ok {
+		return HealthStep{Name: HealthStepCredentials, Status: HealthFailed, Detail: detail}
+	}
+	return HealthStep{Name: HealthStepCredentials, Status: HealthOK, Detail: detail}
+}
+
+// dnsDelegationStep looks up the NS records of zone itself, so a missing delegation is not
+// hidden by the records of a parent zone. When nameservers is set, one NS host must be, or
+// resolve to, one of them.
+func dnsDelegationStep(ctx context.Context, zone string, nameservers []string) (step HealthStep) {
+	step.Name = HealthStepDNS
+	zone = normalizeQName(zone)
+	if zone == "" {
+		return skippedStep(HealthStepDNS, "no dns domain")
+	}
+	start := time.Now()
+	defer func() { step.Latency = time.Since(start) }()
+
+	ns, err := net.DefaultResolver.LookupNS(ctx, zone)
+	if err != nil || len(ns) == 0 {
+		step.Status, step.Detail = HealthFailed, "no NS record found for "+zone
+		if err != nil {
+			step.Detail += ": " + err.Error()
+		}
+		return step
+	}
+	hosts := make([]string, 0, len(ns))
+	for _, n := range ns {
+		hosts = append(hosts, normalizeQName(n.Host))
+	}
+	step.Detail = zone + " NS " + strings.Join(hosts, ",")
+	if len(nameservers) > 0 && !nameserverMatches(ctx, hosts, nameservers) {
+		step.Status = HealthFailed
+		step.Detail += ", expected " + strings.Join(nameservers, ",")
+		return step
+	}
+	step.Status = HealthOK
+	return step
+}
+
+// nameserverMatches reports whether one of the NS hosts is, or resolves to the address of,
+// one of the expected nameservers.
+func nameserverMatches(ctx context.Context, hosts, nameservers []string) bool {
+	want := make(map[string]bool)
+	for _, n := range nameservers {
+		n = normalizeQName(n)
+		want[n] = true
+		if net.ParseIP(n) == nil {
+			addrs, _ := net.DefaultResolver.LookupHost(ctx, n)
+			for _, a := range addrs {
+				want[a] = true
+			}
+		}
+	}
+	for _, h := range hosts {
+		if want[h] {
+			return true
+		}
+		addrs, _ := net.DefaultResolver.LookupHost(ctx, h)
+		for _, a := range addrs {
+			if want[a] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parentZone strips the first label of host, the account label of hosted providers.
+func parentZone(host string) string {
+	host = normalizeQName(host)
+	if strings.Count(host, ".") < 2 {
+		return host
+	}
+	return host[strings.Index(host, ".")+1:]
+}
+
+// apiError returns the error reported in a json api body: a code other than 0 or 200, or
+// a non-empty error field. ok is false when body is not json.
+func apiError(body []byte) (msg string, ok bool) {
+	var v any
+	if err := json.Unmarshal(body, &v); err != nil {
+		return "", false
+	}
+	m, isMap := v.(map[string]any)
+	if !isMap {
+		return "", true
+	}
+	text := firstString(m, "msg", "message", "error", "err")
+	if code, ok := m["code"].(float64); ok && code != 0 && code != 200 {
+		if text == "" {
+			text = fmt.Sprintf("code: %.0f", code)
+		}
+		return text, true
+	}
+	if e, ok := m["error"]; ok && e != nil && e != "" && e != false {
+		return fmt.Sprint(e), true
+	}
+	return "", true
+}
+
+// httpListenerStep requests target, any http response means the listener is reachable.
+func httpListenerStep(ctx context.Context, client *retryhttp.HTTPClient, target string) HealthStep {
+	if target == "" {
+		return skippedStep(HealthStepHTTP, "no http url")
+	}
+	step := HealthStep{Name: HealthStepHTTP}
+	start := time.Now()
+	resp, err := client.Do(ctx, retryhttp.Request{URL: target})
+	step.Latency = time.Since(start)
+	if err != nil {
+		step.Status, step.Detail = HealthFailed, err.Error()
+		return step
+	}
+	step.Status, step.Detail = HealthOK, fmt.Sprintf("status: %d", resp.StatusCode)
+	return step
+}
@@ -0,0 +1,164 @@
+package oobadapter
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// useFakeDNS points net.DefaultResolver at a udp server answering from ns (zone to NS
+// hosts) and a (host to ipv4), every other name is NXDOMAIN.
+func useFakeDNS(t *testing.T, ns map[string][]string, a map[string]string) {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			var req dnsmessage.Message
+			if err := req.Unpack(buf[:n]); err != nil || len(req.Questions) == 0 {
+				continue
+			}
+			q := req.Questions[0]
+			name := strings.TrimSuffix(strings.ToLower(q.Name.String()), ".")
+			resp := dnsmessage.Message{
+				Header:    dnsmessage.Header{ID: req.ID, Response: true, Authoritative: true, RCode: dnsmessage.RCodeNameError},
+				Questions: req.Questions,
+			}
+			hdr := dnsmessage.ResourceHeader{Name: q.Name, Type: q.Type, Class: dnsmessage.ClassINET, TTL: 60}
+			switch {
+			case q.Type == dnsmessage.TypeNS && len(ns[name]) > 0:
+				resp.RCode = dnsmessage.RCodeSuccess
+				for _, h := range ns[name] {
+					resp.Answers = append(resp.Answers, dnsmessage.Resource{Header: hdr, Body: &dnsmessage.NSResource{NS: dnsmessage.MustNewName(h + ".")}})
+				}
+			case q.Type == dnsmessage.TypeA && a[name] != "":
+				resp.RCode = dnsmessage.RCodeSuccess
+				ip := [4]byte(net.ParseIP(a[name]).To4())
+				resp.Answers = append(resp.Answers, dnsmessage.Resource{Header: hdr, Body: &dnsmessage.AResource{A: ip}})
+			case a[name] != "" || len(ns[name]) > 0:
+				resp.RCode = dnsmessage.RCodeSuccess
+			}
+			out, err := resp.Pack()
+			if err != nil {
+				continue
+			}
+			conn.WriteTo(out, addr)
+		}
+	}()
+
+	prev := net.DefaultResolver
+	net.DefaultResolver = &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			return net.Dial("udp", conn.LocalAddr().String())
+		},
+	}
+	t.Cleanup(func() {
+		net.DefaultResolver = prev
+		conn.Close()
+	})
+}
+
+func TestDNSDelegationStep(t *testing.T) {
+	useFakeDNS(t, map[string][]string{
+		"xxx.top":     {"ns1.registrar.test", "ns2.registrar.test"},
+		"ok.xxx.top":  {"ns.oob.test"},
+		"bad.xxx.top": {"ns1.registrar.test"},
+	}, map[string]string{
+		"ns1.registrar.test": "10.0.0.1",
+		"ns2.registrar.test": "10.0.0.2",
+		"ns.oob.test":        "10.0.0.9",
+	})
+	ctx := context.Background()
+
+	// the parent zone has NS records, the missing delegation must still fail
+	if s := dnsDelegationStep(ctx, "log.xxx.top", nil); s.Status != HealthFailed {
+		t.Errorf("missing delegation: %s %s", s.Status, s.Detail)
+	}
+	if s := dnsDelegationStep(ctx, "ok.xxx.top", nil); s.Status != HealthOK {
+		t.Errorf("delegated zone: %s %s", s.Status, s.Detail)
+	}
+	if s := dnsDelegationStep(ctx, "ok.xxx.top", []string{"10.0.0.9"}); s.Status != HealthOK {
+		t.Errorf("expected server ip: %s %s", s.Status, s.Detail)
+	}
+	if s := dnsDelegationStep(ctx, "ok.xxx.top", []string{"ns.oob.test"}); s.Status != HealthOK {
+		t.Errorf("expected server host: %s %s", s.Status, s.Detail)
+	}
+	if s := dnsDelegationStep(ctx, "bad.xxx.top", []string{"10.0.0.9"}); s.Status != HealthFailed {
+		t.Errorf("delegated elsewhere: %s %s", s.Status, s.Detail)
+	}
+	if s := dnsDelegationStep(ctx, "", nil); s.Status != HealthSkipped {
+		t.Errorf("empty zone: %s", s.Status)
+	}
+}
+
+func TestAPIError(t *testing.T) {
+	cases := []struct {
+		body string
+		msg  string
+		ok   bool
+	}{
+		{`{"code":0,"data":{"items":[]}}`, "", true},
+		{`{"code":200,"msg":"ok"}`, "", true},
+		{`[]`, "", true},
+		{`{"code":1,"msg":"invalid token"}`, "invalid token", true},
+		{`{"code":403}`, "code: 403", true},
+		{`{"error":"key not found"}`, "key not found", true},
+		{`{"error":null,"result":{}}`, "", true},
+		{`<html>`, "", false},
+	}
+	for _, c := range cases {
+		msg, ok := apiError([]byte(c.body))
+		if msg != c.msg || ok != c.ok {
+			t.Errorf("%s: got (%q, %v), want (%q, %v)", c.body, msg, ok, c.msg, c.ok)
+		}
+	}
+}
+
+func TestXrayHealthCredentials(t *testing.T) {
+	f := newFakeXray(t)
+	oob := newTestXrayAdapter(t, f, nil)
+	xray := oob.DnsLogModel.(*XrayConnector)
+
+	if _, creds := xray.health(context.Background()); creds.Status != HealthOK {
+		t.Fatalf("valid token: %s %s", creds.Status, creds.Detail)
+	}
+	xray.XToken = "wrong"
+	if _, creds := xray.health(context.Background()); creds.Status != HealthFailed || creds.Detail != "invalid token" {
+		t.Fatalf("wrong token: %s %s", creds.Status, creds.Detail)
+	}
+}
+
+func TestDelegationZones(t *testing.T) {
+	ceye := &CeyeConnector{Domain: "7gn2sm.ceye.io"}
+	if zone, _ := ceye.delegation(); zone != "ceye.io" {
+		t.Errorf("ceye: %s", zone)
+	}
+	xray := &XrayConnector{Domain: "dnslogus.top", XrayDNS: &Xray{Data: XrayData{Server: "1.2.3.4"}}}
+	if zone, ns := xray.delegation(); zone != "dnslogus.top" || len(ns) != 1 || ns[0] != "1.2.3.4" {
+		t.Errorf("xray: %s %v", zone, ns)
+	}
+	// the api host says nothing about the dns server, e.g. behind a reverse proxy
+	revsuit := &RevsuitConnector{DnsDomain: "log.xxx.top", ApiUrl: "https://api.xxx.top/revsuit"}
+	if zone, ns := revsuit.delegation(); zone != "log.xxx.top" || len(ns) != 0 {
+		t.Errorf("revsuit: %s %v", zone, ns)
+	}
+	oob := &OOBAdapter{DnsLogType: RevsuitName, DnsLogModel: revsuit, Params: &ConnectorParams{Nameservers: []string{"10.0.0.9"}}}
+	if zone, ns := oob.delegation(); zone != "log.xxx.top" || len(ns) != 1 || ns[0] != "10.0.0.9" {
+		t.Errorf("revsuit with nameservers: %s %v", zone, ns)
+	}
+	oob = &OOBAdapter{DnsLogType: XrayName, DnsLogModel: xray, Params: &ConnectorParams{Nameservers: []string{"ns.oob.test"}}}
+	if _, ns := oob.delegation(); len(ns) != 1 || ns[0] != "ns.oob.test" {
+		t.Errorf("xray with nameservers: %v", ns)
+	}
+}
@@ -0,0 +1,276 @@
+package oobadapter
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/projectdiscovery/interactsh/pkg/server"
+)
+
+// Interaction is one callback record normalized from any provider's response.
+type Interaction struct {
+	Protocol   string      // dns, http, ldap, rmi, smtp ... empty when the provider does not say
+	QName      string      // dns query name, or http host
+	QType      string      // dns query type, e.g. A, AAAA, TXT
+	Method     string      // http method
+	Path       string      // http request uri, or ldap/rmi path
+	Header     http.Header // http request headers
+	Body       string      // http request body
+	Request    string      // raw request as received by the provider, when it keeps one
+	RemoteAddr string      // source ip
+	Origin     Origin      // set with DefaultOriginClassifier when normalized, see OriginClassifier.Annotate
+	Timestamp  time.Time
+	Raw        string // the record as returned by the provider
+}
+
+var knownProtocols = map[string]string{
+	"dns":   OOBDNS,
+	"http":  OOBHTTP,
+	"https": OOBHTTP,
+	"ldap":  OOBLDAP,
+	"jndi":  OOBLDAP,
+	"rmi":   OOBRMI,
+	"smtp":  "smtp",
+	"ftp":   "ftp",
+	"mysql": "mysql",
+}
+
+// NormalizeRecords splits a provider response body into normalized interactions,
+// each annotated with its Origin by DefaultOriginClassifier.
+func NormalizeRecords(dnsLogType string, body []byte) []Interaction {
+	s := strings.TrimSpace(string(body))
+	if s == "" || (!strings.HasPrefix(s, "{") && !strings.HasPrefix(s, "[")) {
+		return nil
+	}
+	var v any
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		return nil
+	}
+	if dnsLogType == DnslogcnName {
+		if out := normalizeDnslogcn(v); len(out) > 0 {
+			return DefaultOriginClassifier.Annotate(out)
+		}
+	}
+	return DefaultOriginClassifier.Annotate(normalizeJSON(v, providerLocation(dnsLogType)))
+}
+
+// normalizeDnslogcn handles dnslog.cn records: [["sub.xxx.dnslog.cn","1.2.3.4","2006-01-02 15:04:05"], ...]
+func normalizeDnslogcn(v any) []Interaction {
+	rows, ok := v.([]any)
+	if !ok {
+		return nil
+	}
+	out := make([]Interaction, 0, len(rows))
+	for _, row := range rows {
+		cols, ok := row.([]any)
+		if !ok || len(cols) == 0 {
+			continue
+		}
+		raw, _ := json.Marshal(cols)
+		it := Interaction{
+			Protocol:  OOBDNS,
+			QName:     normalizeQName(stringAny(cols[0])),
+			Timestamp: time.Now().UTC(),
+			Raw:       string(raw),
+		}
+		if len(cols) > 1 {
+			it.RemoteAddr = normalizeRemoteAddr(stringAny(cols[1]))
+		}
+		if len(cols) > 2 {
+			it.Timestamp = guessTimeFromMap(map[string]any{"time": cols[2]}, it.Timestamp, providerLocation(DnslogcnName))
+		}
+		out = append(out, it)
+	}
+	return out
+}
+
+func normalizeJSON(v any, loc *time.Location) []Interaction {
+	switch vv := v.(type) {
+	case []any:
+		out := make([]Interaction, 0, len(vv))
+		for _, it := range vv {
+			out = append(out, normalizeJSON(it, loc)...)
+		}
+		return out
+	case map[string]any:
+		for _, k := range []string{"data", "items", "list", "records", "result"} {
+			if data, ok := vv[k]; ok {
+				switch data.(type) {
+				case []any, map[string]any:
+					return normalizeJSON(data, loc)
+				}
+			}
+		}
+		return []Interaction{normalizeMap(vv, loc)}
+	default:
+		return nil
+	}
+}
+
+func firstString(m map[string]any, keys ...string) string {
+	for _, k := range keys {
+		if v, ok := m[k].(string); ok {
+			if v = strings.TrimSpace(v); v != "" {
+				return v
+			}
+		}
+	}
+	return ""
+}
+
+func normalizeMap(m map[string]any, loc *time.Location) Interaction {
+	raw, _ := json.Marshal(m)
+	it := Interaction{
+		Timestamp: guessTimeFromMap(m, time.Now().UTC(), loc),
+		Raw:       string(raw),
+	}
+	if rt := firstString(m, "request_time"); rt != "" {
+		if ts, err := time.Parse(time.RFC3339Nano, rt); err == nil {
+			it.Timestamp = ts.UTC()
+		}
+	}
+
+	for _, k := range []string{"protocol", "eventType", "event_type", "type"} {
+		s := strings.ToLower(firstString(m, k))
+		if s == "" {
+			continue
+		}
+		if p, ok := knownProtocols[s]; ok {
+			it.Protocol = p
+			break
+		}
+		if k == "type" && isDNSQType(s) {
+			it.QType = strings.ToUpper(s)
+		}
+	}
+	if qt := firstString(m, "q-type", "qtype", "query_type", "dns_type"); qt != "" {
+		it.QType = strings.ToUpper(qt)
+	}
+
+	it.QName = normalizeQName(firstString(m, "full-id", "domain", "subdomain", "qname", "hostname", "host"))
+	it.Method = strings.ToUpper(firstString(m, "method"))
+	it.Path = firstString(m, "path", "uri")
+	it.RemoteAddr = normalizeRemoteAddr(firstString(m, "remote-address", "remote_addr", "remoteAddr", "remote_ip", "src_ip", "ip"))
+
+	if rawReq := firstString(m, "raw-request", "raw_request", "request", "raw"); rawReq != "" {
+		it.Request = rawReq
+		method, uri, host, header, body := parseRawHTTPRequest(rawReq)
+		if method != "" {
+			if it.Method == "" {
+				it.Method = method
+			}
+			if it.Path == "" {
+				it.Path = uri
+			}
+			if it.QName == "" {
+				it.QName = normalizeQName(host)
+			}
+			it.Header = header
+			it.Body = body
+		}
+	}
+
+	if u := firstString(m, "url", "name"); u != "" {
+		host, path := splitURL(u)
+		if it.QName == "" {
+			it.QName = normalizeQName(host)
+		}
+		if it.Path == "" && path != "" {
+			it.Path = path
+		}
+	}
+	if ua := firstString(m, "user_agent", "userAgent", "user-agent"); ua != "" {
+		if it.Header == nil {
+			it.Header = http.Header{}
+		}
+		if it.Header.Get("User-Agent") == "" {
+			it.Header.Set("User-Agent", ua)
+		}
+	}
+
+	if it.Protocol == "" && it.Method != "" {
+		it.Protocol = OOBHTTP
+	}
+	if it.Protocol == "" && it.QType != "" {
+		it.Protocol = OOBDNS
+	}
+	return it
+}
+
+// normalizeInteractsh converts an interaction received from the interactsh server.
+func normalizeInteractsh(in server.Interaction) Interaction {
+	raw, _ := json.Marshal(in)
+	it := Interaction{
+		Protocol:   strings.ToLower(strings.TrimSpace(in.Protocol)),
+		QName:      normalizeQName(in.FullId),
+		QType:      strings.ToUpper(strings.TrimSpace(in.QType)),
+		RemoteAddr: normalizeRemoteAddr(in.RemoteAddress),
+		Request:    in.RawRequest,
+		Timestamp:  in.Timestamp,
+		Raw:        string(raw),
+	}
+	if p, ok := knownProtocols[it.Protocol]; ok {
+		it.Protocol = p
+	}
+	if it.Protocol == OOBHTTP && in.RawRequest != "" {
+		it.Method, it.Path, _, it.Header, it.Body = parseRawHTTPRequest(in.RawRequest)
+	}
+	it.Origin = DefaultOriginClassifier.Classify(it)
+	return it
+}
+
+func isDNSQType(s string) bool {
+	switch strings.ToUpper(s) {
+	case "A", "AAAA", "CNAME", "MX", "NS", "TXT", "SOA", "PTR", "SRV", "CAA", "ANY":
+		return true
+	}
+	return false
+}
+
+func normalizeQName(s string) string {
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(s), "."))
+}
+
+// normalizeRemoteAddr strips the port from host:port addresses.
+func normalizeRemoteAddr(s string) string {
+	s = strings.TrimSpace(s)
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		return host
+	}
+	return strings.Trim(s, "[]")
+}
+
+func splitURL(s string) (string, string) {
+	if !strings.Contains(s, "://") {
+		if strings.HasPrefix(s, "/") {
+			return "", s
+		}
+		return strings.Split(s, "/")[0], ""
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return "", ""
+	}
+	return u.Hostname(), u.RequestURI()
+}
+
+// parseRawHTTPRequest extracts the request line, headers and body of a raw http request.
+func parseRawHTTPRequest(raw string) (method, uri, host string, header http.Header, body string) {
+	raw = strings.TrimLeft(raw, "\r\n ")
+	if !strings.Contains(raw, "\r\n\r\n") && !strings.Contains(raw, "\n\n") {
+		raw = strings.TrimRight(raw, "\r\n") + "\r\n\r\n"
+	}
+	req, err := http.ReadRequest(bufio.NewReader(strings.NewReader(raw)))
+	if err != nil {
+		return "", "", "", nil, ""
+	}
+	defer req.Body.Close()
+	b, _ := io.ReadAll(io.LimitReader(req.Body, 1<<20))
+	return req.Method, req.RequestURI, req.Host, req.Header, string(b)
+}
@@ -1,26 +1,38 @@
 package oobadapter
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/url"
+	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/projectdiscovery/interactsh/pkg/client"
+	"github.com/projectdiscovery/interactsh/pkg/options"
 	"github.com/projectdiscovery/interactsh/pkg/server"
+	"github.com/projectdiscovery/retryablehttp-go"
+	randutil "github.com/zan8in/pins/rand"
+	"gopkg.in/yaml.v3"
 )
 
 var (
-	InteractshName = "interactsh"
+	InteractshName        = "interactsh"
+	InteractshNonceLength = 8
 )
 
 type InteractshConnector struct {
-	c       *client.Client
-	mu      sync.Mutex
-	records []server.Interaction
-	isAlive bool
+	c           *client.Client
+	http        *retryablehttp.Client // 轮询和注册使用的客户端，Close 时释放空闲连接
+	mu          sync.Mutex
+	records     *interactshBuffer
+	sessionFile string
+	isAlive     bool
+	signer      *filterSigner
+	issued      *issueLog
 }
 
 func NewInteractshConnector(params *ConnectorParams) (*InteractshConnector, error) {
@@ -32,15 +44,49 @@ func NewInteractshConnector(params *ConnectorParams) (*InteractshConnector, erro
 	if t := strings.TrimSpace(params.Key); t != "" {
 		opts.Token = t
 	}
-
-	cli, err := client.New(&opts)
+	httpClient, err := params.httpClient()
 	if err != nil {
 		return nil, err
 	}
+	if httpClient != nil {
+		opts.HTTPClient = retryablehttp.NewWithHTTPClient(httpClient.StdClient(), retryablehttp.DefaultOptionsSingle)
+	} else {
+		// same as the client's own default, kept so Close can release its connections
+		o := retryablehttp.DefaultOptionsSpraying
+		o.Timeout = 10 * time.Second
+		opts.HTTPClient = retryablehttp.NewClient(o)
+	}
+
+	sessionFile := strings.TrimSpace(params.SessionFile)
+	var cli *client.Client
+	if sessionFile != "" {
+		if info, err := loadInteractshSession(sessionFile); err == nil {
+			resumeOpts := opts
+			resumeOpts.SessionInfo = info
+			// a broken or foreign session falls back to a fresh registration
+			cli, _ = client.New(&resumeOpts)
+		}
+	}
+	if cli == nil {
+		if cli, err = client.New(&opts); err != nil {
+			closeIdleConnections(opts.HTTPClient)
+			return nil, err
+		}
+	}
+	if sessionFile != "" {
+		if err := saveInteractshSession(cli, sessionFile); err != nil {
+			_ = cli.Close()
+			return nil, err
+		}
+	}
 	ic := &InteractshConnector{
-		c:       cli,
-		records: make([]server.Interaction, 0, 64),
-		isAlive: true,
+		c:           cli,
+		http:        opts.HTTPClient,
+		records:     newInteractshBuffer(params.MaxRecords, params.RecordTTL),
+		sessionFile: sessionFile,
+		isAlive:     true,
+		signer:      newFilterSigner(params.SignKey),
+		issued:      params.issueLog(),
 	}
 
 	_ = cli.StartPolling(2*time.Second, func(interaction *server.Interaction) {
@@ -48,16 +94,18 @@ func NewInteractshConnector(params *ConnectorParams) (*InteractshConnector, erro
 			return
 		}
 		ic.mu.Lock()
-		ic.records = append(ic.records, *interaction)
-		if len(ic.records) > 500 {
-			ic.records = ic.records[len(ic.records)-500:]
-		}
+		ic.records.add(*interaction, time.Now())
 		ic.mu.Unlock()
 	})
 
 	return ic, nil
 }
 
+// GetValidationDomain prepends a nonce label to the client url, the server reports it back
+// in full-id: nonce.correlationid. The client url already ends its first label with a random
+// nonce, but that nonce is glued to the correlation id and comes from the client, so it cannot
+// carry the HMAC of SignFilters. The prepended label is the filter token: FilterToken and the
+// correlation store key on it, and with SignFilters it is the signed token.
 func (c *InteractshConnector) GetValidationDomain() ValidationDomains {
 	if c == nil || c.c == nil {
 		return ValidationDomains{}
@@ -85,24 +133,44 @@ func (c *InteractshConnector) GetValidationDomain() ValidationDomains {
 		filter = strings.TrimSpace(parts[0])
 	}
 
-	return ValidationDomains{
-		HTTP:   httpURL,
-		DNS:    host,
-		Filter: filter,
+	nonce := c.signer.token(randutil.RandLowercase(InteractshNonceLength))
+	host = nonce + "." + host
+	filter = nonce + "." + filter
+	if pu != nil && err == nil {
+		pu.Host = nonce + "." + pu.Host
+		httpURL = pu.String()
 	}
+
+	d := ValidationDomains{
+		HTTP:     httpURL,
+		DNS:      host,
+		Filter:   filter,
+		IssuedAt: time.Now(),
+	}
+	c.issued.add(d)
+	return d
 }
 
 func (c *InteractshConnector) ValidateResult(params ValidateParams) Result {
 	if c == nil {
 		return Result{IsVaild: false, DnslogType: InteractshName, FilterType: params.FilterType}
 	}
+	params = c.issued.withIssuedAt(params)
+	if !c.signer.verifyFilter(params.Filter) {
+		return invalidSignature(InteractshName, params)
+	}
 	filterType := strings.ToLower(strings.TrimSpace(params.FilterType))
 	filter := strings.ToLower(strings.TrimSpace(params.Filter))
 
 	c.mu.Lock()
-	all := append([]server.Interaction(nil), c.records...)
+	all := c.records.lookup(filter, time.Now())
 	c.mu.Unlock()
 
+	var extra *compiledMatcher
+	if m, ok := params.conditions(); ok {
+		extra = m.compile()
+	}
+
 	out := make([]server.Interaction, 0, len(all))
 	matched := false
 	for _, it := range all {
@@ -116,7 +184,10 @@ func (c *InteractshConnector) ValidateResult(params ValidateParams) Result {
 			out = append(out, it)
 			continue
 		}
-		if strings.Contains(strings.ToLower(it.FullId), filter) || strings.Contains(strings.ToLower(it.UniqueID), filter) {
+		if extra != nil && !extra.match(normalizeInteractsh(it)) {
+			continue
+		}
+		if matchInteractshFullID(it.FullId, filter) {
 			matched = true
 			out = append(out, it)
 		}
@@ -132,13 +203,144 @@ func (c *InteractshConnector) ValidateResult(params ValidateParams) Result {
 	return Result{IsVaild: matched, DnslogType: InteractshName, FilterType: params.FilterType, Body: body}
 }
 
+func (c *InteractshConnector) matcher(params ValidateParams) Matcher {
+	m := Matcher{Filter: params.Filter}
+	if params.FilterType == OOBHTTP || params.FilterType == OOBDNS {
+		m.Protocol = params.FilterType
+	}
+	return m
+}
+
+// Stats returns the interaction buffer counters.
+func (c *InteractshConnector) Stats() InteractshStats {
+	if c == nil || c.records == nil {
+		return InteractshStats{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.records.snapshot()
+}
+
+// matchInteractshFullID reports whether the interaction's full subdomain ends with filter,
+// labels prepended by the payload (e.g. exfiltrated data) are allowed.
+func matchInteractshFullID(fullID, filterLower string) bool {
+	fullID = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(fullID), "."))
+	if fullID == "" || filterLower == "" {
+		return false
+	}
+	return fullID == filterLower || strings.HasSuffix(fullID, "."+filterLower)
+}
+
+func loadInteractshSession(filename string) (*options.SessionInfo, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	info := &options.SessionInfo{}
+	if err := yaml.Unmarshal(data, info); err != nil {
+		return nil, err
+	}
+	if info.ServerURL == "" || info.CorrelationID == "" || info.SecretKey == "" || info.PrivateKey == "" {
+		return nil, fmt.Errorf("invalid interactsh session file: %s", filename)
+	}
+	return info, nil
+}
+
+// saveInteractshSession writes the session readable by the owner only, it holds the private
+// key. SaveSessionTo creates files world readable, so it writes into a 0600 temp file next to
+// filename, which is then renamed over it.
+func saveInteractshSession(cli *client.Client, filename string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".tmp*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmpName)
+		return err
+	}
+	if err := cli.SaveSessionTo(tmpName); err != nil {
+		_ = os.Remove(tmpName)
+		return err
+	}
+	if err := os.Rename(tmpName, filename); err != nil {
+		_ = os.Remove(tmpName)
+		return err
+	}
+	return nil
+}
+
+// SaveSession writes the session (server url, correlation id, secret and private key)
+// to filename so a later NewInteractshConnector can resume polling it.
+func (c *InteractshConnector) SaveSession(filename string) error {
+	if c == nil || c.c == nil {
+		return fmt.Errorf("interactsh client is nil")
+	}
+	return saveInteractshSession(c.c, filename)
+}
+
+// Close stops polling, deregisters the session from the server and removes the session file.
+func (c *InteractshConnector) Close() error {
+	if c == nil || c.c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	if !c.isAlive {
+		c.mu.Unlock()
+		return nil
+	}
+	c.isAlive = false
+	c.mu.Unlock()
+
+	_ = c.c.StopPolling()
+	err := c.c.Close()
+	closeIdleConnections(c.http)
+	if err != nil {
+		return err
+	}
+	if c.sessionFile != "" {
+		if err := os.Remove(c.sessionFile); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
 func (c *InteractshConnector) IsVaild() bool {
 	if c == nil {
 		return false
 	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	return c.isAlive && c.c != nil
 }
 
+// health reports the polling session, the token is only checked when registering.
+func (c *InteractshConnector) health(ctx context.Context) (HealthStep, HealthStep) {
+	api := HealthStep{Name: HealthStepAPI, Status: HealthOK, Detail: "polling"}
+	if !c.IsVaild() {
+		api.Status, api.Detail = HealthFailed, "session closed"
+	}
+	return api, skippedStep(HealthStepCredentials, "checked on registration")
+}
+
+// delegation is the zone of the interactsh server, the client url is correlationid.zone.
+func (c *InteractshConnector) delegation() (string, []string) {
+	if c == nil || c.c == nil {
+		return "", nil
+	}
+	u := c.c.URL()
+	if i := strings.Index(u, "://"); i >= 0 {
+		u = u[i+3:]
+	}
+	u, _, _ = strings.Cut(u, "/")
+	u, _, _ = strings.Cut(u, ":")
+	if i := strings.Index(u, "."); i >= 0 {
+		u = u[i+1:]
+	}
+	return u, nil
+}
+
 func (c *InteractshConnector) GetFilterType(t string) string {
 	switch t {
 	case OOBHTTP:
@@ -156,3 +358,15 @@ func (c *InteractshConnector) String() string {
 	}
 	return fmt.Sprintf("interactsh<%s>", c.c.URL())
 }
+
+func closeIdleConnections(c *retryablehttp.Client) {
+	if c == nil {
+		return
+	}
+	if c.HTTPClient != nil {
+		c.HTTPClient.CloseIdleConnections()
+	}
+	if c.HTTPClient2 != nil {
+		c.HTTPClient2.CloseIdleConnections()
+	}
+}
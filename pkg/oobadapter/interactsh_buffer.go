@@ -0,0 +1,145 @@
+package oobadapter
+
+import (
+	"strings"
+	"time"
+
+	"github.com/projectdiscovery/interactsh/pkg/server"
+)
+
+var (
+	InteractshMaxRecords = 500
+)
+
+// InteractshStats counts what the interaction buffer has received and evicted.
+type InteractshStats struct {
+	Received       uint64 // interactions received from the server
+	Buffered       int    // interactions currently retained
+	EvictedByCount uint64 // dropped because the buffer was full
+	EvictedByAge   uint64 // dropped because they were older than the retention age
+}
+
+type interactshEntry struct {
+	at   time.Time
+	keys []string
+	it   server.Interaction
+}
+
+// interactshBuffer keeps interactions in arrival order, bounded by count and age,
+// with an index from filter (the trailing labels of full-id) to its interactions.
+type interactshBuffer struct {
+	maxCount int
+	maxAge   time.Duration
+	entries  []*interactshEntry
+	index    map[string][]*interactshEntry
+	stats    InteractshStats
+}
+
+func newInteractshBuffer(maxCount int, maxAge time.Duration) *interactshBuffer {
+	if maxCount <= 0 {
+		maxCount = InteractshMaxRecords
+	}
+	return &interactshBuffer{
+		maxCount: maxCount,
+		maxAge:   maxAge,
+		entries:  make([]*interactshEntry, 0, 64),
+		index:    make(map[string][]*interactshEntry),
+	}
+}
+
+// interactshIndexKeys returns the last one and two labels of full-id, which is
+// what a filter (correlation id, or nonce.correlationid) looks like.
+func interactshIndexKeys(fullID string) []string {
+	fullID = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(fullID), "."))
+	if fullID == "" {
+		return nil
+	}
+	parts := strings.Split(fullID, ".")
+	keys := []string{parts[len(parts)-1]}
+	if len(parts) > 1 {
+		keys = append(keys, strings.Join(parts[len(parts)-2:], "."))
+	}
+	return keys
+}
+
+func (b *interactshBuffer) add(it server.Interaction, now time.Time) {
+	e := &interactshEntry{
+		at:   now,
+		keys: interactshIndexKeys(it.FullId),
+		it:   it,
+	}
+	b.entries = append(b.entries, e)
+	for _, k := range e.keys {
+		b.index[k] = append(b.index[k], e)
+	}
+	b.stats.Received++
+
+	for len(b.entries) > b.maxCount {
+		b.evictOldest()
+		b.stats.EvictedByCount++
+	}
+	b.expire(now)
+}
+
+// expire drops interactions older than maxAge.
+func (b *interactshBuffer) expire(now time.Time) {
+	if b.maxAge <= 0 {
+		return
+	}
+	for len(b.entries) > 0 && now.Sub(b.entries[0].at) > b.maxAge {
+		b.evictOldest()
+		b.stats.EvictedByAge++
+	}
+}
+
+// evictOldest removes the first entry, which is also the first entry of each index list it belongs to.
+func (b *interactshBuffer) evictOldest() {
+	e := b.entries[0]
+	b.entries[0] = nil
+	b.entries = b.entries[1:]
+	for _, k := range e.keys {
+		list := b.index[k]
+		if len(list) > 0 && list[0] == e {
+			list[0] = nil
+			list = list[1:]
+		}
+		if len(list) == 0 {
+			delete(b.index, k)
+		} else {
+			b.index[k] = list
+		}
+	}
+}
+
+// lookup returns the interactions whose full-id ends with filter, or every interaction when filter is empty.
+func (b *interactshBuffer) lookup(filterLower string, now time.Time) []server.Interaction {
+	b.expire(now)
+	if filterLower == "" {
+		out := make([]server.Interaction, 0, len(b.entries))
+		for _, e := range b.entries {
+			out = append(out, e.it)
+		}
+		return out
+	}
+	if strings.Count(filterLower, ".") > 1 {
+		out := make([]server.Interaction, 0)
+		for _, e := range b.entries {
+			if matchInteractshFullID(e.it.FullId, filterLower) {
+				out = append(out, e.it)
+			}
+		}
+		return out
+	}
+	list := b.index[filterLower]
+	out := make([]server.Interaction, 0, len(list))
+	for _, e := range list {
+		out = append(out, e.it)
+	}
+	return out
+}
+
+func (b *interactshBuffer) snapshot() InteractshStats {
+	s := b.stats
+	s.Buffered = len(b.entries)
+	return s
+}
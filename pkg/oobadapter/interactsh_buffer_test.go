@@ -0,0 +1,85 @@
+package oobadapter
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/projectdiscovery/interactsh/pkg/server"
+)
+
+func fullIDs(items []server.Interaction) []string {
+	out := make([]string, 0, len(items))
+	for _, it := range items {
+		out = append(out, it.FullId)
+	}
+	return out
+}
+
+func TestInteractshBufferEvictByCount(t *testing.T) {
+	b := newInteractshBuffer(3, 0)
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		b.add(server.Interaction{FullId: fmt.Sprintf("n%d.cid%d", i, i%2)}, now)
+	}
+	if got := fullIDs(b.lookup("", now)); fmt.Sprint(got) != "[n2.cid0 n3.cid1 n4.cid0]" {
+		t.Errorf("buffered: %v", got)
+	}
+	// the index drops evicted entries with the buffer
+	if got := fullIDs(b.lookup("cid0", now)); fmt.Sprint(got) != "[n2.cid0 n4.cid0]" {
+		t.Errorf("cid0: %v", got)
+	}
+	if got := b.lookup("n0.cid0", now); len(got) != 0 {
+		t.Errorf("evicted entry still indexed: %v", got)
+	}
+	if _, ok := b.index["n0.cid0"]; ok {
+		t.Error("empty index list kept")
+	}
+	s := b.snapshot()
+	if s.Received != 5 || s.Buffered != 3 || s.EvictedByCount != 2 || s.EvictedByAge != 0 {
+		t.Errorf("stats: %+v", s)
+	}
+}
+
+func TestInteractshBufferEvictByAge(t *testing.T) {
+	b := newInteractshBuffer(0, time.Minute)
+	now := time.Now()
+	b.add(server.Interaction{FullId: "old.cid"}, now.Add(-2*time.Minute))
+	b.add(server.Interaction{FullId: "new.cid"}, now)
+
+	if got := fullIDs(b.lookup("cid", now)); fmt.Sprint(got) != "[new.cid]" {
+		t.Errorf("cid: %v", got)
+	}
+	// lookups expire on their own, without a new interaction
+	if got := b.lookup("cid", now.Add(2*time.Minute)); len(got) != 0 {
+		t.Errorf("expired: %v", fullIDs(got))
+	}
+	s := b.snapshot()
+	if s.Buffered != 0 || s.EvictedByAge != 2 || s.EvictedByCount != 0 {
+		t.Errorf("stats: %+v", s)
+	}
+	if b.maxCount != InteractshMaxRecords {
+		t.Errorf("default max count: %d", b.maxCount)
+	}
+}
+
+func TestInteractshBufferLookup(t *testing.T) {
+	b := newInteractshBuffer(0, 0)
+	now := time.Now()
+	for _, id := range []string{"abc.cid1", "xyz.abc.cid1", "CID2.", "abc.cid2"} {
+		b.add(server.Interaction{FullId: id}, now)
+	}
+	cases := map[string]string{
+		"cid1":         "[abc.cid1 xyz.abc.cid1]",
+		"abc.cid1":     "[abc.cid1 xyz.abc.cid1]",
+		"cid2":         "[CID2. abc.cid2]",
+		"xyz.abc.cid1": "[xyz.abc.cid1]",
+		"abc":          "[]",
+		"cid3":         "[]",
+	}
+	for filter, want := range cases {
+		if got := fullIDs(b.lookup(filter, now)); fmt.Sprint(got) != want {
+			t.Errorf("%s: got %v, want %s", filter, got, want)
+		}
+	}
+}
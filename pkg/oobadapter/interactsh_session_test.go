@@ -0,0 +1,71 @@
+package oobadapter
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// checkSessionMode fails unless filename is readable by the owner only.
+func checkSessionMode(t *testing.T, filename string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		return
+	}
+	info, err := os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("session file mode: %o", mode)
+	}
+}
+
+func TestInteractshSessionRoundTrip(t *testing.T) {
+	srv, calls := newFakeInteractsh(t)
+	sessionFile := filepath.Join(t.TempDir(), "interactsh.yaml")
+	// a leftover world readable file that is not a session
+	if err := os.WriteFile(sessionFile, []byte("not a session"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := NewInteractshConnector(&ConnectorParams{Domain: srv.URL, SessionFile: sessionFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSessionMode(t, sessionFile)
+	saved, err := loadInteractshSession(sessionFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the process exits without deregistering
+	_ = first.c.StopPolling()
+	closeIdleConnections(first.http)
+
+	second, err := NewInteractshConnector(&ConnectorParams{Domain: srv.URL, SessionFile: sessionFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSessionMode(t, sessionFile)
+	resumed, err := loadInteractshSession(sessionFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resumed.CorrelationID != saved.CorrelationID || resumed.SecretKey != saved.SecretKey || resumed.PrivateKey != saved.PrivateKey {
+		t.Error("session not resumed")
+	}
+	if matches, _ := filepath.Glob(sessionFile + ".tmp*"); len(matches) != 0 {
+		t.Errorf("temp files left: %v", matches)
+	}
+
+	if err := second.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if calls("/deregister") != 1 {
+		t.Errorf("deregister calls: %d", calls("/deregister"))
+	}
+	if _, err := os.Stat(sessionFile); !os.IsNotExist(err) {
+		t.Errorf("session file not removed: %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+package oobadapter
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ChinaStandardTime is the zone of ceye.io and dnslog.cn record times, which carry no offset.
+	ChinaStandardTime = time.FixedZone("CST", 8*60*60)
+
+	// ProviderLocations is the zone of record timestamps without an offset per dnslog type,
+	// UTC when missing.
+	ProviderLocations = map[string]*time.Location{
+		CeyeName:     ChinaStandardTime,
+		DnslogcnName: ChinaStandardTime,
+	}
+
+	DefaultIssueLogSize = 100000 // 记录签发时间的 filter 数量上限
+)
+
+func providerLocation(dnsLogType string) *time.Location {
+	if loc, ok := ProviderLocations[dnsLogType]; ok && loc != nil {
+		return loc
+	}
+	return time.UTC
+}
+
+// issueLog remembers when each filter was issued, so ValidateResult rejects older records
+// even when the caller does not pass IssuedAt. The oldest filters are forgotten first.
+type issueLog struct {
+	mu    sync.Mutex
+	max   int
+	at    map[string]time.Time
+	order []string
+}
+
+func newIssueLog(max int) *issueLog {
+	if max <= 0 {
+		max = DefaultIssueLogSize
+	}
+	return &issueLog{max: max, at: make(map[string]time.Time)}
+}
+
+// add records the issue time of d.
+func (l *issueLog) add(d ValidationDomains) {
+	if l == nil || d.Filter == "" || d.IssuedAt.IsZero() {
+		return
+	}
+	key := strings.ToLower(d.Filter)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.at[key]; !ok {
+		l.order = append(l.order, key)
+	}
+	l.at[key] = d.IssuedAt
+	for len(l.order) > l.max {
+		delete(l.at, l.order[0])
+		l.order = l.order[1:]
+	}
+}
+
+// withIssuedAt fills params.IssuedAt from the log when the caller left it empty.
+func (l *issueLog) withIssuedAt(params ValidateParams) ValidateParams {
+	if l == nil || !params.IssuedAt.IsZero() || params.Filter == "" {
+		return params
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if at, ok := l.at[strings.ToLower(params.Filter)]; ok {
+		params.IssuedAt = at
+	}
+	return params
+}
@@ -0,0 +1,80 @@
+package oobadapter
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestProviderLocation(t *testing.T) {
+	at := time.Now().Add(-5 * time.Hour).Truncate(time.Second)
+	cst := at.In(ChinaStandardTime).Format("2006-01-02 15:04:05")
+
+	body := fmt.Sprintf(`{"meta":{"code":200},"data":[{"id":"1","name":"abc.x.ceye.io","remote_addr":"1.2.3.4","created_at":%q}]}`, cst)
+	its := NormalizeRecords(CeyeName, []byte(body))
+	if len(its) != 1 || !its[0].Timestamp.Equal(at) {
+		t.Fatalf("ceye: got %v, want %v", its, at)
+	}
+
+	body = fmt.Sprintf(`[["abc.x.dnslog.cn","1.2.3.4",%q]]`, cst)
+	its = NormalizeRecords(DnslogcnName, []byte(body))
+	if len(its) != 1 || !its[0].Timestamp.Equal(at) {
+		t.Fatalf("dnslogcn: got %v, want %v", its, at)
+	}
+
+	// a ceye record from before the domain was issued is rejected
+	m := Matcher{Filter: "abc", NotBefore: time.Now().Add(-DefaultClockSkew)}
+	if got := m.Select(its); len(got) != 0 {
+		t.Fatalf("stale record selected: %v", got)
+	}
+
+	utc := at.UTC().Format("2006-01-02 15:04:05")
+	its = NormalizeRecords(XrayName, []byte(fmt.Sprintf(`[{"domain":"abc.x.test","time":%q}]`, utc)))
+	if len(its) != 1 || !its[0].Timestamp.Equal(at) {
+		t.Fatalf("xray: got %v, want %v", its, at)
+	}
+}
+
+func TestValidateResultRemembersIssuedAt(t *testing.T) {
+	f := newFakeXray(t)
+	oob := newTestXrayAdapter(t, f, &ConnectorParams{RecordCacheTTL: -1})
+
+	stale := oob.GetValidationDomain()
+	f.dnsHitAt(stale.DNS, stale.IssuedAt.Add(-time.Hour))
+	fresh := oob.GetValidationDomain()
+	f.dnsHit(fresh.DNS)
+
+	// no IssuedAt passed, the connector applies the window on its own
+	if res := oob.ValidateResult(ValidateParams{Filter: stale.Filter, FilterType: OOBDNS}); res.IsVaild {
+		t.Error("record older than the issue time accepted")
+	}
+	if res := oob.ValidateResult(ValidateParams{Filter: fresh.Filter, FilterType: OOBDNS}); !res.IsVaild {
+		t.Error("fresh record rejected")
+	}
+	// the batch path shares the log
+	res := oob.ValidateBatch([]ValidateParams{
+		{Filter: stale.Filter, FilterType: OOBDNS},
+		{Filter: fresh.Filter, FilterType: OOBDNS},
+	})
+	if res[stale.Filter].IsVaild || !res[fresh.Filter].IsVaild {
+		t.Errorf("batch: stale %v, fresh %v", res[stale.Filter].IsVaild, res[fresh.Filter].IsVaild)
+	}
+}
+
+func TestIssueLogEviction(t *testing.T) {
+	l := newIssueLog(2)
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		l.add(ValidationDomains{Filter: fmt.Sprintf("F%d", i), IssuedAt: now.Add(time.Duration(i) * time.Second)})
+	}
+	if p := l.withIssuedAt(ValidateParams{Filter: "f0"}); !p.IssuedAt.IsZero() {
+		t.Error("oldest filter kept")
+	}
+	if p := l.withIssuedAt(ValidateParams{Filter: "f2"}); !p.IssuedAt.Equal(now.Add(2 * time.Second)) {
+		t.Errorf("f2: %v", p.IssuedAt)
+	}
+	explicit := now.Add(time.Hour)
+	if p := l.withIssuedAt(ValidateParams{Filter: "f2", IssuedAt: explicit}); !p.IssuedAt.Equal(explicit) {
+		t.Error("explicit IssuedAt overridden")
+	}
+}
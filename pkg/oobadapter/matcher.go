@@ -0,0 +1,255 @@
+package oobadapter
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Matcher holds conditions evaluated against each normalized interaction,
+// an interaction matches when every non-empty condition holds.
+type Matcher struct {
+	Filter      string            // 过滤规则，需作为完整的域名标签或路径段出现
+	Protocol    string            // 协议，比如：dns, http, ldap, rmi
+	QNameSuffix string            // 域名后缀，比如：.yyy.ceye.io
+	QType       string            // dns 查询类型，比如：A, AAAA, TXT
+	Method      string            // http 方法，比如：GET
+	Path        string            // http 路径前缀，比如：/log/
+	Header      map[string]string // http 请求头，值为包含匹配，比如：User-Agent: curl
+	BodyRegex   string            // http 请求体正则
+	SourceCIDR  []string          // 来源 ip 网段，比如：10.0.0.0/8
+	NotBefore   time.Time         // 交互时间不早于该时间
+
+	IgnoreOrigins []Origin          // 忽略的来源，比如：resolver, scanner
+	Classifier    *OriginClassifier // 来源分类器，默认 DefaultOriginClassifier
+}
+
+type compiledMatcher struct {
+	Matcher
+	body  *regexp.Regexp
+	cidrs []*net.IPNet
+	err   error
+}
+
+// ParseMatcher parses a whitespace separated list of key:value conditions, e.g.
+//
+//	protocol:http method:GET path:/api header:User-Agent=curl body:^id= cidr:10.0.0.0/8,192.168.0.0/16
+//
+// keys: filter, protocol, qname, qtype, method, path, header, body, cidr.
+func ParseMatcher(expr string) (*Matcher, error) {
+	m := &Matcher{}
+	for _, field := range strings.Fields(expr) {
+		k, v, ok := strings.Cut(field, ":")
+		if !ok || v == "" {
+			return nil, fmt.Errorf("invalid matcher condition: %s", field)
+		}
+		switch strings.ToLower(k) {
+		case "filter":
+			m.Filter = v
+		case "protocol":
+			m.Protocol = v
+		case "qname":
+			m.QNameSuffix = v
+		case "qtype":
+			m.QType = v
+		case "method":
+			m.Method = v
+		case "path":
+			m.Path = v
+		case "header":
+			name, value, ok := strings.Cut(v, "=")
+			if !ok {
+				return nil, fmt.Errorf("invalid header condition: %s", v)
+			}
+			if m.Header == nil {
+				m.Header = map[string]string{}
+			}
+			m.Header[name] = value
+		case "body":
+			m.BodyRegex = v
+		case "cidr":
+			m.SourceCIDR = append(m.SourceCIDR, strings.Split(v, ",")...)
+		default:
+			return nil, fmt.Errorf("unknown matcher key: %s", k)
+		}
+	}
+	if c := m.compile(); c.err != nil {
+		return nil, c.err
+	}
+	return m, nil
+}
+
+func (m Matcher) compile() *compiledMatcher {
+	c := &compiledMatcher{Matcher: m}
+	if m.BodyRegex != "" {
+		if c.body, c.err = regexp.Compile(m.BodyRegex); c.err != nil {
+			return c
+		}
+	}
+	c.cidrs, c.err = parseCIDRs(m.SourceCIDR)
+	return c
+}
+
+// Match reports whether it satisfies every condition of m.
+func (m Matcher) Match(it Interaction) bool {
+	return m.compile().match(it)
+}
+
+// Select returns the interactions that satisfy every condition of m.
+func (m Matcher) Select(items []Interaction) []Interaction {
+	c := m.compile()
+	out := make([]Interaction, 0)
+	for _, it := range items {
+		if c.match(it) {
+			out = append(out, it)
+		}
+	}
+	return out
+}
+
+func (c *compiledMatcher) match(it Interaction) bool {
+	if c.err != nil {
+		return false
+	}
+	if !c.NotBefore.IsZero() && !it.Timestamp.IsZero() && it.Timestamp.Before(c.NotBefore) {
+		return false
+	}
+	if len(c.IgnoreOrigins) > 0 {
+		// a custom classifier overrides the origin set by NormalizeRecords
+		origin := it.Origin
+		if c.Classifier != nil {
+			origin = c.Classifier.Classify(it)
+		} else if origin == "" {
+			origin = DefaultOriginClassifier.Classify(it)
+		}
+		for _, o := range c.IgnoreOrigins {
+			if o == origin {
+				return false
+			}
+		}
+	}
+	if c.Filter != "" && !containsLabels(it.QName, c.Filter) && !containsSegment(it.Path, c.Filter) {
+		return false
+	}
+	// records that do not carry a protocol are trusted to the endpoint they were fetched from
+	if c.Protocol != "" && it.Protocol != "" && !strings.EqualFold(normalizeProtocol(c.Protocol), it.Protocol) {
+		return false
+	}
+	if c.QNameSuffix != "" && !strings.HasSuffix(it.QName, normalizeQName(c.QNameSuffix)) {
+		return false
+	}
+	if c.QType != "" && !strings.EqualFold(c.QType, it.QType) {
+		return false
+	}
+	if c.Method != "" && !strings.EqualFold(c.Method, it.Method) {
+		return false
+	}
+	if c.Path != "" && !strings.HasPrefix(strings.ToLower(it.Path), strings.ToLower(c.Path)) {
+		return false
+	}
+	for k, v := range c.Header {
+		if it.Header == nil || !strings.Contains(strings.ToLower(it.Header.Get(k)), strings.ToLower(v)) {
+			return false
+		}
+	}
+	if c.body != nil && !c.body.MatchString(it.Body) {
+		return false
+	}
+	if len(c.cidrs) > 0 {
+		ip := net.ParseIP(it.RemoteAddr)
+		if ip == nil {
+			return false
+		}
+		in := false
+		for _, n := range c.cidrs {
+			if n.Contains(ip) {
+				in = true
+				break
+			}
+		}
+		if !in {
+			return false
+		}
+	}
+	return true
+}
+
+func normalizeProtocol(p string) string {
+	p = strings.ToLower(strings.TrimSpace(p))
+	if v, ok := knownProtocols[p]; ok {
+		return v
+	}
+	return p
+}
+
+// containsLabels reports whether filter appears as whole labels of qname.
+func containsLabels(qname, filter string) bool {
+	qname = normalizeQName(qname)
+	filter = normalizeQName(filter)
+	if qname == "" || filter == "" {
+		return false
+	}
+	return strings.Contains("."+qname+".", "."+filter+".")
+}
+
+// containsSegment reports whether filter appears as whole segments of the path.
+func containsSegment(path, filter string) bool {
+	path, _, _ = strings.Cut(path, "?")
+	path = strings.ToLower(strings.Trim(path, "/"))
+	filter = strings.ToLower(strings.Trim(filter, "/"))
+	if path == "" || filter == "" {
+		return false
+	}
+	return strings.Contains("/"+path+"/", "/"+filter+"/")
+}
+
+// conditions returns the caller's per-record conditions, including the issue time window,
+// and whether there are any.
+func (p ValidateParams) conditions() (Matcher, bool) {
+	m := Matcher{}
+	if p.Matcher != nil {
+		m = *p.Matcher
+	}
+	if !p.IssuedAt.IsZero() {
+		skew := p.ClockSkew
+		if skew == 0 {
+			skew = DefaultClockSkew
+		}
+		m.NotBefore = p.IssuedAt.Add(-skew)
+	}
+	if len(p.IgnoreOrigins) > 0 {
+		m.IgnoreOrigins = append(m.IgnoreOrigins, p.IgnoreOrigins...)
+		if m.Classifier == nil {
+			m.Classifier = p.Classifier
+		}
+	}
+	return m, p.Matcher != nil || !m.NotBefore.IsZero() || len(m.IgnoreOrigins) > 0
+}
+
+// matcher merges the caller's conditions into the connector's default ones.
+func (p ValidateParams) matcher(def Matcher) Matcher {
+	m, ok := p.conditions()
+	if !ok {
+		return def
+	}
+	if m.Filter == "" {
+		m.Filter = def.Filter
+	}
+	if m.Protocol == "" {
+		m.Protocol = def.Protocol
+	}
+	if m.Path == "" {
+		m.Path = def.Path
+	}
+	if m.QNameSuffix == "" {
+		m.QNameSuffix = def.QNameSuffix
+	}
+	return m
+}
+
+// matchBody reports whether any record in body satisfies m.
+func matchBody(dnsLogType string, body []byte, m Matcher) bool {
+	return len(m.Select(NormalizeRecords(dnsLogType, body))) > 0
+}
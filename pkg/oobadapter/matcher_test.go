@@ -0,0 +1,104 @@
+package oobadapter
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseMatcher(t *testing.T) {
+	m, err := ParseMatcher("protocol:http method:GET path:/api header:User-Agent=curl body:^id= cidr:10.0.0.0/8,192.168.0.0/16")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Protocol != "http" || m.Method != "GET" || m.Path != "/api" || m.Header["User-Agent"] != "curl" ||
+		m.BodyRegex != "^id=" || len(m.SourceCIDR) != 2 {
+		t.Fatalf("parsed: %+v", m)
+	}
+
+	for _, expr := range []string{"protocol", "method:", "unknown:x", "header:User-Agent", "body:(", "cidr:10.0.0.0/33"} {
+		if _, err := ParseMatcher(expr); err == nil {
+			t.Errorf("%s: expected error", expr)
+		}
+	}
+}
+
+func TestMatcher(t *testing.T) {
+	hit := Interaction{
+		Protocol:   OOBHTTP,
+		QName:      "abc.dnslog.test",
+		Method:     "POST",
+		Path:       "/api/abc?x=1",
+		Header:     http.Header{"User-Agent": {"curl/8.0"}},
+		Body:       "id=1",
+		RemoteAddr: "10.1.2.3",
+		Timestamp:  time.Now(),
+	}
+	cases := []struct {
+		m    Matcher
+		want bool
+	}{
+		{Matcher{}, true},
+		{Matcher{Filter: "abc"}, true},
+		{Matcher{Filter: "ab"}, false},
+		{Matcher{Protocol: "https"}, true},
+		{Matcher{Protocol: OOBDNS}, false},
+		{Matcher{QNameSuffix: ".dnslog.test"}, true},
+		{Matcher{QNameSuffix: ".other.test"}, false},
+		{Matcher{Method: "post"}, true},
+		{Matcher{Method: "GET"}, false},
+		{Matcher{Path: "/API/"}, true},
+		{Matcher{Path: "/log/"}, false},
+		{Matcher{Header: map[string]string{"user-agent": "CURL"}}, true},
+		{Matcher{Header: map[string]string{"Referer": "abc"}}, false},
+		{Matcher{BodyRegex: "^id="}, true},
+		{Matcher{BodyRegex: "^name="}, false},
+		{Matcher{SourceCIDR: []string{"192.168.0.0/16", "10.0.0.0/8"}}, true},
+		{Matcher{SourceCIDR: []string{"192.168.0.0/16"}}, false},
+		{Matcher{NotBefore: hit.Timestamp.Add(-time.Minute)}, true},
+		{Matcher{NotBefore: hit.Timestamp.Add(time.Minute)}, false},
+		{Matcher{BodyRegex: "("}, false},
+	}
+	for i, c := range cases {
+		if got := c.m.Match(hit); got != c.want {
+			t.Errorf("case %d %+v: got %v, want %v", i, c.m, got, c.want)
+		}
+	}
+}
+
+func TestRevsuitMatcher(t *testing.T) {
+	c := &RevsuitConnector{DnsDomain: "log.xxx.top", HTTPFlag: getRevsuitHTTPFlag("http://1.2.3.4/log")}
+	httpBody := []byte(`{"error":null,"result":{"count":3,"data":[
+		{"flag":"abcdef","method":"GET","uri":"/other?x=/log/abcdef","remote_ip":"1.1.1.1"},
+		{"flag":"abcdef","method":"GET","uri":"/other","raw":"GET /other HTTP/1.1\r\nHost: x\r\nReferer: http://1.2.3.4/log/abcdef\r\n\r\n","remote_ip":"1.1.1.1"},
+		{"flag":"zzzzzz","method":"GET","uri":"/log/zzzzzz","remote_ip":"1.1.1.1"}
+	]},"status":"succeed"}`)
+	dnsBody := []byte(`{"error":null,"result":{"count":2,"data":[
+		{"flag":"abcdef","domain":"abcdef.other.top","type":"A","remote_ip":"1.1.1.1"},
+		{"flag":"abcdefg","domain":"abcdefg.log.xxx.top","type":"A","remote_ip":"1.1.1.1"}
+	]},"status":"succeed"}`)
+
+	// the token only in a query string, a referer, another dnslog domain or a longer label
+	httpParams := ValidateParams{Filter: "abcdef", FilterType: OOBHTTP}
+	if matchBody(RevsuitName, httpBody, httpParams.matcher(c.matcher(httpParams))) {
+		t.Error("http: token outside the flag path matched")
+	}
+	dnsParams := ValidateParams{Filter: "abcdef", FilterType: OOBDNS}
+	if matchBody(RevsuitName, dnsBody, dnsParams.matcher(c.matcher(dnsParams))) {
+		t.Error("dns: token outside the dnslog domain matched")
+	}
+
+	httpParams.Filter = "ZZZZZZ"
+	if !matchBody(RevsuitName, httpBody, httpParams.matcher(c.matcher(httpParams))) {
+		t.Error("http: flag path not matched")
+	}
+	dnsParams.Filter = "abcdefg"
+	if !matchBody(RevsuitName, dnsBody, dnsParams.matcher(c.matcher(dnsParams))) {
+		t.Error("dns: flag label not matched")
+	}
+	// caller conditions keep the connector's dnslog domain
+	dnsParams.Matcher = &Matcher{QType: "A"}
+	if !matchBody(RevsuitName, dnsBody, dnsParams.matcher(c.matcher(dnsParams))) {
+		t.Error("dns: qtype condition not matched")
+	}
+}
@@ -0,0 +1,197 @@
+package oobadapter
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Origin classifies who made an interaction.
+type Origin string
+
+var (
+	OriginUnknown  Origin = "unknown"
+	OriginTarget   Origin = "target"   // the host under test
+	OriginResolver Origin = "resolver" // a recursive resolver querying on someone's behalf
+	OriginScanner  Origin = "scanner"  // mail gateways, link previewers and other prefetchers
+)
+
+// KnownResolverCIDRs are well-known public resolvers and their egress ranges.
+var KnownResolverCIDRs = []string{
+	"8.8.8.0/24", "8.8.4.0/24", "74.125.0.0/16", "172.253.0.0/16", "2001:4860::/32", // google
+	"1.1.1.0/24", "1.0.0.0/24", "162.158.0.0/15", "172.64.0.0/13", "2606:4700::/32", // cloudflare
+	"9.9.9.0/24", "149.112.112.0/24", "2620:fe::/48", // quad9
+	"208.67.216.0/21", "2620:119::/32", // opendns
+	"114.114.114.0/24", "114.114.115.0/24", // 114dns
+	"223.5.5.0/24", "223.6.6.0/24", // alidns
+	"119.29.29.0/24", "119.28.28.0/24", // dnspod
+	"180.76.76.0/24", // baidu
+}
+
+// KnownScannerUserAgents are User-Agent fragments of mail gateways and link previewers.
+var KnownScannerUserAgents = []string{
+	"googlebot", "bingbot", "slackbot", "twitterbot", "facebookexternalhit", "linkedinbot",
+	"discordbot", "telegrambot", "whatsapp", "skypeuripreview", "microsoft office",
+	"proofpoint", "mimecast", "barracuda", "urlscan", "safebrowsing",
+}
+
+// OriginClassifier annotates interactions with their Origin. User supplied target and
+// scanner lists take precedence over the built-in resolver list, which only applies to dns.
+type OriginClassifier struct {
+	mu         sync.RWMutex
+	cidrs      map[Origin][]*net.IPNet
+	userAgents []string
+}
+
+// DefaultOriginClassifier only knows the built-in resolver ranges and scanner User-Agents.
+var DefaultOriginClassifier = NewOriginClassifier()
+
+func NewOriginClassifier() *OriginClassifier {
+	c := &OriginClassifier{
+		cidrs: make(map[Origin][]*net.IPNet),
+	}
+	_ = c.AddCIDRs(OriginResolver, KnownResolverCIDRs...)
+	c.AddUserAgents(KnownScannerUserAgents...)
+	return c
+}
+
+// AddCIDRs classifies the given networks (or single ips) as origin.
+func (c *OriginClassifier) AddCIDRs(origin Origin, cidrs ...string) error {
+	nets, err := parseCIDRs(cidrs)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.cidrs[origin] = append(c.cidrs[origin], nets...)
+	c.mu.Unlock()
+	return nil
+}
+
+// parseCIDRs parses networks, single ips are treated as /32 or /128.
+func parseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, s := range cidrs {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if !strings.Contains(s, "/") {
+			if ip := net.ParseIP(s); ip != nil && ip.To4() != nil {
+				s += "/32"
+			} else {
+				s += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// AddUserAgents classifies http interactions whose User-Agent contains any fragment as scanner.
+func (c *OriginClassifier) AddUserAgents(fragments ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, s := range fragments {
+		if s = strings.ToLower(strings.TrimSpace(s)); s != "" {
+			c.userAgents = append(c.userAgents, s)
+		}
+	}
+}
+
+// LoadCIDRFile reads one cidr or ip per line, lines starting with # are ignored.
+func (c *OriginClassifier) LoadCIDRFile(origin Origin, filename string) error {
+	lines, err := readListFile(filename)
+	if err != nil {
+		return err
+	}
+	if err := c.AddCIDRs(origin, lines...); err != nil {
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+	return nil
+}
+
+// LoadUserAgentFile reads one User-Agent fragment per line, lines starting with # are ignored.
+func (c *OriginClassifier) LoadUserAgentFile(filename string) error {
+	lines, err := readListFile(filename)
+	if err != nil {
+		return err
+	}
+	c.AddUserAgents(lines...)
+	return nil
+}
+
+func readListFile(filename string) ([]string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	out := make([]string, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		out = append(out, line)
+	}
+	return out, scanner.Err()
+}
+
+// Classify returns the origin of it.
+func (c *OriginClassifier) Classify(it Interaction) Origin {
+	if c == nil {
+		return OriginUnknown
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	ip := net.ParseIP(it.RemoteAddr)
+	in := func(origin Origin) bool {
+		if ip == nil {
+			return false
+		}
+		for _, n := range c.cidrs[origin] {
+			if n.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if in(OriginTarget) {
+		return OriginTarget
+	}
+	if in(OriginScanner) {
+		return OriginScanner
+	}
+	if it.Header != nil {
+		ua := strings.ToLower(it.Header.Get("User-Agent"))
+		for _, s := range c.userAgents {
+			if ua != "" && strings.Contains(ua, s) {
+				return OriginScanner
+			}
+		}
+	}
+	// resolvers only make dns queries, an http hit from the same range is someone else
+	if it.Protocol == OOBDNS && in(OriginResolver) {
+		return OriginResolver
+	}
+	return OriginUnknown
+}
+
+// Annotate sets Origin on every interaction.
+func (c *OriginClassifier) Annotate(items []Interaction) []Interaction {
+	for i := range items {
+		items[i].Origin = c.Classify(items[i])
+	}
+	return items
+}
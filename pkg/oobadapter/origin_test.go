@@ -0,0 +1,61 @@
+package oobadapter
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestClassifyResolverOnlyDNS(t *testing.T) {
+	c := NewOriginClassifier()
+	dns := Interaction{Protocol: OOBDNS, RemoteAddr: "8.8.8.8"}
+	if got := c.Classify(dns); got != OriginResolver {
+		t.Errorf("dns from resolver: %s", got)
+	}
+	// cloudflare egress ranges also front http clients
+	web := Interaction{Protocol: OOBHTTP, RemoteAddr: "162.158.1.1"}
+	if got := c.Classify(web); got != OriginUnknown {
+		t.Errorf("http from resolver range: %s", got)
+	}
+	web.Header = http.Header{"User-Agent": {"Slackbot-LinkExpanding 1.0"}}
+	if got := c.Classify(web); got != OriginScanner {
+		t.Errorf("http from link previewer: %s", got)
+	}
+	if err := c.AddCIDRs(OriginTarget, "8.8.8.8"); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Classify(dns); got != OriginTarget {
+		t.Errorf("dns from target: %s", got)
+	}
+}
+
+func TestNormalizeRecordsOrigin(t *testing.T) {
+	body := []byte(`{"code":0,"data":{"items":[
+		{"protocol":"dns","domain":"abc.dnslog.test","remote_addr":"8.8.8.8"},
+		{"protocol":"http","url":"http://dnslog.test/abc","method":"GET","remote_addr":"162.158.1.1"},
+		{"protocol":"dns","domain":"abc.dnslog.test","remote_addr":"10.1.2.3"}
+	]}}`)
+	its := NormalizeRecords(XrayName, body)
+	want := []Origin{OriginResolver, OriginUnknown, OriginUnknown}
+	if len(its) != len(want) {
+		t.Fatalf("got %d interactions", len(its))
+	}
+	for i, it := range its {
+		if it.Origin != want[i] {
+			t.Errorf("%d: origin %s, want %s", i, it.Origin, want[i])
+		}
+	}
+
+	// a custom classifier overrides the annotated origin
+	c := NewOriginClassifier()
+	if err := c.AddCIDRs(OriginTarget, "8.8.8.8"); err != nil {
+		t.Fatal(err)
+	}
+	m := Matcher{Filter: "abc", IgnoreOrigins: []Origin{OriginResolver}}
+	if got := m.Select(its); len(got) != 2 {
+		t.Errorf("default classifier: %d selected", len(got))
+	}
+	m.Classifier = c
+	if got := m.Select(its); len(got) != 3 {
+		t.Errorf("custom classifier: %d selected", len(got))
+	}
+}
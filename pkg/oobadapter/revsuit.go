@@ -1,19 +1,26 @@
 package oobadapter
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/zan8in/oobadapter/pkg/retryhttp"
 	randutil "github.com/zan8in/pins/rand"
 )
 
 var (
-	RevsuitName      = "revsuit"
-	RevsuitDNS       = "dns"
-	RevsuitHTTP      = "http"
-	RevsuitSubLength = 8
+	RevsuitName       = "revsuit"
+	RevsuitDNS        = "dns"
+	RevsuitHTTP       = "http"
+	RevsuitSubLength  = 8
+	RevsuitRulePrefix = "oobadapter-"
 )
 
 type RevsuitConnector struct {
@@ -22,37 +29,184 @@ type RevsuitConnector struct {
 	DnsDomain string // your Revsuit dnslog domain.
 	Filter    string // match url name rule, the filter max length is 20.
 	ApiUrl    string
+	HTTPFlag  string // http flag template, e.g. /log/%s
+	DNSFlag   string // dns flag template, e.g. %s.log.xxx.net
+	AutoRule  bool   // rules were created by the connector and are removed on Close.
 	IsAlive   bool
+	mu        sync.Mutex // guards IsAlive and AutoRule
+	signer    *filterSigner
+	http      *retryhttp.HTTPClient
+	fetches   *recordCache
+	issued    *issueLog
+}
+
+// revsuitRule is the subset of a Revsuit rule the connector creates and deletes.
+type revsuitRule struct {
+	Name               string `json:"name"`
+	FlagFormat         string `json:"flag_format"`
+	Rank               int    `json:"rank"`
+	PushToClient       bool   `json:"push_to_client"`
+	Notice             bool   `json:"notice"`
+	Type               string `json:"type,omitempty"`
+	Value              string `json:"value,omitempty"`
+	TTL                int    `json:"ttl,omitempty"`
+	ResponseStatusCode string `json:"response_status_code,omitempty"`
+	ResponseBody       string `json:"response_body,omitempty"`
 }
 
 func NewRevsuitConnector(params *ConnectorParams) (*RevsuitConnector, error) {
+	client, err := params.httpClient()
+	if err != nil {
+		return nil, err
+	}
 	url := fmt.Sprintf("%s/api/record/dns?page=1&pageSize=1&order=desc", params.ApiUrl)
 	cookie := fmt.Sprintf("token=%s", params.Key)
-	if status, _ := retryhttp.GetByCookie(url, cookie); status != 0 {
-		return &RevsuitConnector{
-			Token:     params.Key,
-			DnsDomain: params.Domain,
-			HTTPUrl:   params.HTTPUrl,
-			Filter:    randutil.Randcase(RevsuitSubLength),
-			ApiUrl:    params.ApiUrl,
-			IsAlive:   true,
-		}, nil
-	} else {
+	if status, _ := client.GetByCookie(url, cookie); status == 0 {
 		return nil, fmt.Errorf("new RevsuitConnector failed")
 	}
+	c := &RevsuitConnector{
+		Token:     params.Key,
+		DnsDomain: params.Domain,
+		HTTPUrl:   params.HTTPUrl,
+		Filter:    randutil.Randcase(RevsuitSubLength),
+		ApiUrl:    params.ApiUrl,
+		HTTPFlag:  getRevsuitHTTPFlag(params.HTTPUrl),
+		DNSFlag:   "%s." + params.Domain,
+		IsAlive:   true,
+		signer:    newFilterSigner(params.SignKey),
+		http:      client,
+		fetches:   newRecordCache(params.RecordCacheTTL),
+		issued:    params.issueLog(),
+	}
+	if params.AutoRule {
+		if err := c.createRules(); err != nil {
+			_ = c.deleteRules()
+			return nil, err
+		}
+		c.AutoRule = true
+	}
+	return c, nil
+}
+
+// getRevsuitHTTPFlag derives the http flag template from the path of the httplog url,
+// http://xxx.com/log becomes /log/%s.
+func getRevsuitHTTPFlag(httpUrl string) string {
+	p := ""
+	if u, err := url.Parse(strings.TrimSpace(httpUrl)); err == nil {
+		p = strings.Trim(u.Path, "/")
+	}
+	if p == "" {
+		return "/%s"
+	}
+	return "/" + p + "/%s"
+}
+
+func (c *RevsuitConnector) ruleName() string {
+	return RevsuitRulePrefix + c.Filter
+}
+
+func (c *RevsuitConnector) rules() map[string]revsuitRule {
+	flagFormat := func(tpl string) string {
+		parts := strings.SplitN(tpl, "%s", 2)
+		return regexp.QuoteMeta(parts[0]) + fmt.Sprintf("[a-zA-Z0-9]{%d}", c.signer.tokenLength(RevsuitSubLength)) + regexp.QuoteMeta(parts[1])
+	}
+	rules := map[string]revsuitRule{
+		RevsuitDNS: {
+			Name:       c.ruleName(),
+			FlagFormat: flagFormat(c.DNSFlag),
+			Rank:       1,
+			Type:       "A",
+			Value:      "127.0.0.1",
+			TTL:        10,
+		},
+	}
+	if len(c.HTTPUrl) > 0 {
+		rules[RevsuitHTTP] = revsuitRule{
+			Name:               c.ruleName(),
+			FlagFormat:         flagFormat(c.HTTPFlag),
+			Rank:               1,
+			ResponseStatusCode: "200",
+		}
+	}
+	return rules
+}
+
+func (c *RevsuitConnector) ruleRequest(method, kind string, rule revsuitRule) error {
+	body, err := json.Marshal(rule)
+	if err != nil {
+		return err
+	}
+	status, resp := c.http.DoWithHeader(method, fmt.Sprintf("%s/api/rule/%s", c.ApiUrl, kind), string(body), map[string]string{
+		"Cookie":       fmt.Sprintf("token=%s", c.Token),
+		"Content-Type": "application/json",
+	})
+	if status == 0 || status >= 400 {
+		return fmt.Errorf("revsuit %s rule %s failed, status: %d, body: %s", kind, rule.Name, status, string(resp))
+	}
+	return nil
+}
+
+func (c *RevsuitConnector) createRules() error {
+	for kind, rule := range c.rules() {
+		if err := c.ruleRequest("POST", kind, rule); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *RevsuitConnector) deleteRules() error {
+	var lastErr error
+	for kind, rule := range c.rules() {
+		if err := c.ruleRequest("DELETE", kind, revsuitRule{Name: rule.Name}); err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// Close removes the rules created by the connector when AutoRule is enabled, then drops
+// the cached records and the idle connections.
+func (c *RevsuitConnector) Close() error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	if !c.IsAlive {
+		c.mu.Unlock()
+		return nil
+	}
+	c.IsAlive = false
+	autoRule := c.AutoRule
+	c.AutoRule = false
+	c.mu.Unlock()
+
+	var err error
+	if autoRule {
+		err = c.deleteRules()
+	}
+	c.fetches.reset()
+	c.http.CloseIdleConnections()
+	return err
 }
 
 func (c *RevsuitConnector) GetValidationDomain() ValidationDomains {
-	randomFilter := randutil.Randcase(RevsuitSubLength)
+	randomFilter := c.signer.token(randutil.Randcase(RevsuitSubLength))
 	validationDomain := ValidationDomains{
-		HTTP:   fmt.Sprintf("%s/%s", strings.TrimSuffix(c.HTTPUrl, "/"), randomFilter), // http://x.x.x.x:8777/log/randstr
-		DNS:    fmt.Sprintf("%s.%s", randomFilter, c.DnsDomain),                        // xxx.log.xxx.net
-		Filter: randomFilter,
+		HTTP:     fmt.Sprintf("%s/%s", strings.TrimSuffix(c.HTTPUrl, "/"), randomFilter), // http://x.x.x.x:8777/log/randstr
+		DNS:      fmt.Sprintf("%s.%s", randomFilter, c.DnsDomain),                        // xxx.log.xxx.net
+		Filter:   randomFilter,
+		IssuedAt: time.Now(),
 	}
+	c.issued.add(validationDomain)
 	return validationDomain
 }
 
 func (c *RevsuitConnector) ValidateResult(params ValidateParams) Result {
+	params = c.issued.withIssuedAt(params)
+	if !c.signer.verifyFilter(params.Filter) {
+		return invalidSignature(RevsuitName, params)
+	}
 	switch c.GetFilterType(params.FilterType) {
 	case RevsuitDNS:
 		return c.validate(params)
@@ -88,14 +242,16 @@ func (c *RevsuitConnector) validate(params ValidateParams) Result {
 	if params.FilterType == OOBDNS {
 		url = fmt.Sprintf("%s/api/record/dns?page=1&pageSize=100&order=desc", c.ApiUrl)
 	}
-	status, body := retryhttp.GetByCookie(url, cookie)
+	status, body := c.fetches.fetch(url, func() (int, []byte) {
+		return c.http.GetByCookie(url, cookie)
+	})
 	if status != 0 {
-		if matched, filteredBody := filterRevsuitBody(params.FilterType, c.DnsDomain, params.Filter, body); matched {
+		if matchBody(RevsuitName, body, params.matcher(c.matcher(params))) {
 			return Result{
 				IsVaild:    true,
 				DnslogType: RevsuitName,
 				FilterType: params.FilterType,
-				Body:       filteredBody,
+				Body:       string(body),
 			}
 		}
 	}
@@ -104,6 +260,7 @@ func (c *RevsuitConnector) validate(params ValidateParams) Result {
 		DnslogType: RevsuitName,
 		FilterType: params.FilterType,
 		Body:       string(body),
+		Err:        requestError(RevsuitName, status),
 	}
 }
 
@@ -116,79 +273,21 @@ type revsuitAPIResponse struct {
 	Status string `json:"status"`
 }
 
-func filterRevsuitBody(filterType, dnsDomain, filter string, body []byte) (bool, string) {
-	filterLower := strings.ToLower(strings.TrimSpace(filter))
-	if filterLower == "" || len(body) == 0 {
-		return false, string(body)
-	}
-
-	resp := revsuitAPIResponse{}
-	if err := json.Unmarshal(body, &resp); err != nil {
-		return filterRevsuitBodyFallback(filterType, dnsDomain, filterLower, body)
-	}
-
-	domainLower := strings.ToLower(strings.TrimSpace(dnsDomain))
-	matched := false
-	out := make([]map[string]any, 0, len(resp.Result.Data))
-	for _, it := range resp.Result.Data {
-		if it == nil {
-			continue
-		}
-		if matchRevsuitRecord(filterType, domainLower, filterLower, it) {
-			matched = true
-			out = append(out, it)
+// matcher matches http hits under the flag prefix, e.g. /log/filter, and dns hits on
+// the filter label under the dnslog domain.
+func (c *RevsuitConnector) matcher(params ValidateParams) Matcher {
+	if params.FilterType == OOBHTTP {
+		prefix, _, _ := strings.Cut(c.HTTPFlag, "%s")
+		return Matcher{
+			Filter:   params.Filter,
+			Protocol: OOBHTTP,
+			Path:     prefix,
 		}
 	}
-	if !matched {
-		return false, string(body)
-	}
-
-	resp.Result.Data = out
-	resp.Result.Count = len(out)
-	b, err := json.Marshal(resp)
-	if err != nil {
-		return true, string(body)
-	}
-	return true, string(b)
-}
-
-func filterRevsuitBodyFallback(filterType, dnsDomainLower, filterLower string, body []byte) (bool, string) {
-	bodyLower := strings.ToLower(string(body))
-	switch filterType {
-	case OOBHTTP:
-		if strings.Contains(bodyLower, "/log/"+filterLower) {
-			return true, string(body)
-		}
-	case OOBDNS:
-		domainLower := strings.ToLower(strings.TrimSpace(dnsDomainLower))
-		if strings.Contains(bodyLower, `"`+"flag"+`":"`+filterLower+`"`) ||
-			(domainLower != "" && strings.Contains(bodyLower, filterLower+"."+domainLower)) ||
-			strings.Contains(bodyLower, filterLower+".") {
-			return true, string(body)
-		}
-	}
-	return false, string(body)
-}
-
-func matchRevsuitRecord(filterType, dnsDomainLower, filterLower string, it map[string]any) bool {
-	switch filterType {
-	case OOBHTTP:
-		uri := strings.ToLower(strings.TrimSpace(stringAny(it["uri"])))
-		flag := strings.ToLower(strings.TrimSpace(stringAny(it["flag"])))
-		token := "/log/" + filterLower
-		return strings.Contains(uri, token) || strings.Contains(flag, token)
-	case OOBDNS:
-		domain := strings.ToLower(strings.TrimSpace(stringAny(it["domain"])))
-		flag := strings.ToLower(strings.TrimSpace(stringAny(it["flag"])))
-		if dnsDomainLower != "" && domain != "" && !strings.HasSuffix(domain, dnsDomainLower) {
-			return false
-		}
-		if hasTokenSegment(flag, filterLower) {
-			return true
-		}
-		return hasTokenSegment(domain, filterLower)
-	default:
-		return false
+	return Matcher{
+		Filter:      params.Filter,
+		Protocol:    OOBDNS,
+		QNameSuffix: c.DnsDomain,
 	}
 }
 
@@ -201,22 +300,36 @@ func stringAny(v any) string {
 	}
 }
 
-func hasTokenSegment(s, token string) bool {
-	if s == "" || token == "" {
-		return false
-	}
-	parts := strings.Split(s, ".")
-	for _, p := range parts {
-		if p == token {
-			return true
-		}
-	}
-	return strings.HasPrefix(s, token+".") || strings.Contains(s, "."+token+".")
-}
-
 func (c *RevsuitConnector) IsVaild() bool {
 	if c != nil {
+		c.mu.Lock()
+		defer c.mu.Unlock()
 		return c.IsAlive
 	}
 	return false
 }
+
+// health checks the records api with the token cookie, revsuit reports a bad token in error.
+func (c *RevsuitConnector) health(ctx context.Context) (HealthStep, HealthStep) {
+	api, resp := apiStep(ctx, c.http, retryhttp.Request{
+		URL:     fmt.Sprintf("%s/api/record/dns?page=1&pageSize=1&order=desc", c.ApiUrl),
+		Cookies: []*http.Cookie{{Name: "token", Value: c.Token}},
+	})
+	if resp == nil {
+		return api, credentialStep(nil, false, "")
+	}
+	v := revsuitAPIResponse{}
+	if err := json.Unmarshal(resp.Body, &v); err != nil {
+		return api, credentialStep(resp, false, "invalid response: "+err.Error())
+	}
+	if v.Error != nil {
+		return api, credentialStep(resp, false, fmt.Sprint(v.Error))
+	}
+	return api, credentialStep(resp, true, "token valid")
+}
+
+// delegation is the dnslog domain. The revsuit dns server is not necessarily the host of
+// the api, e.g. behind a reverse proxy, so its address comes from ConnectorParams.Nameservers.
+func (c *RevsuitConnector) delegation() (string, []string) {
+	return c.DnsDomain, nil
+}
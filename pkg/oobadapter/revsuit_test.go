@@ -0,0 +1,152 @@
+package oobadapter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"sync"
+	"testing"
+)
+
+type revsuitRuleRequest struct {
+	Method string
+	Kind   string
+	Cookie string
+	Rule   map[string]any
+}
+
+// fakeRevsuit is a revsuit server that records the rule requests and answers the record
+// apis with an empty list.
+type fakeRevsuit struct {
+	*httptest.Server
+	mu    sync.Mutex
+	rules []revsuitRuleRequest
+}
+
+func newFakeRevsuit(t *testing.T) *fakeRevsuit {
+	t.Helper()
+	f := &fakeRevsuit{}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		switch r.URL.Path {
+		case "/api/record/dns", "/api/record/http":
+			fmt.Fprint(w, `{"error":null,"result":{"count":0,"data":[]},"status":"succeed"}`)
+		case "/api/rule/dns", "/api/rule/http":
+			req := revsuitRuleRequest{Method: r.Method, Kind: r.URL.Path[len("/api/rule/"):]}
+			if c, err := r.Cookie("token"); err == nil {
+				req.Cookie = c.Value
+			}
+			body, _ := io.ReadAll(r.Body)
+			if err := json.Unmarshal(body, &req.Rule); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			f.rules = append(f.rules, req)
+			fmt.Fprint(w, `{"error":null,"result":null,"status":"succeed"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+// ruleRequests returns the rule requests sent with method by kind, and how many there were.
+func (f *fakeRevsuit) ruleRequests(method string) (map[string]revsuitRuleRequest, int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := map[string]revsuitRuleRequest{}
+	n := 0
+	for _, r := range f.rules {
+		if r.Method == method {
+			out[r.Kind] = r
+			n++
+		}
+	}
+	return out, n
+}
+
+func TestRevsuitRules(t *testing.T) {
+	for _, sign := range []bool{false, true} {
+		t.Run(fmt.Sprintf("sign=%v", sign), func(t *testing.T) {
+			f := newFakeRevsuit(t)
+			oob, err := NewOOBAdapter(RevsuitName, &ConnectorParams{
+				Key:         "token",
+				Domain:      "log.xxx.top",
+				ApiUrl:      f.URL,
+				HTTPUrl:     "http://10.0.0.9:10000/log",
+				AutoRule:    true,
+				SignFilters: sign,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			revsuit := oob.DnsLogModel.(*RevsuitConnector)
+
+			created, n := f.ruleRequests(http.MethodPost)
+			if len(created) != 2 || n != 2 {
+				t.Fatalf("created rules: %v", created)
+			}
+			for kind, r := range created {
+				if r.Cookie != "token" {
+					t.Errorf("%s: cookie %q", kind, r.Cookie)
+				}
+				if r.Rule["name"] != revsuit.ruleName() || r.Rule["rank"] != float64(1) {
+					t.Errorf("%s: rule %v", kind, r.Rule)
+				}
+			}
+			if r := created[RevsuitDNS].Rule; r["type"] != "A" || r["value"] != "127.0.0.1" {
+				t.Errorf("dns rule: %v", r)
+			}
+			if r := created[RevsuitHTTP].Rule; r["response_status_code"] != "200" {
+				t.Errorf("http rule: %v", r)
+			}
+
+			// the flag formats accept the filters the connector hands out
+			dnsFlag := regexp.MustCompile("^" + created[RevsuitDNS].Rule["flag_format"].(string) + "$")
+			httpFlag := regexp.MustCompile("^" + created[RevsuitHTTP].Rule["flag_format"].(string) + "$")
+			for i := 0; i < 20; i++ {
+				d := oob.GetValidationDomain()
+				if !dnsFlag.MatchString(d.DNS) {
+					t.Errorf("dns flag %s rejects %s", dnsFlag, d.DNS)
+				}
+				u, err := url.Parse(d.HTTP)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !httpFlag.MatchString(u.Path) {
+					t.Errorf("http flag %s rejects %s", httpFlag, u.Path)
+				}
+			}
+			if dnsFlag.MatchString("abc.log.xxx.top") || httpFlag.MatchString("/log/abc") {
+				t.Error("flag formats accept short filters")
+			}
+
+			if err := oob.Close(); err != nil {
+				t.Fatal(err)
+			}
+			deleted, n := f.ruleRequests(http.MethodDelete)
+			if len(deleted) != 2 || n != 2 {
+				t.Fatalf("deleted rules: %v", deleted)
+			}
+			for kind, r := range deleted {
+				// only the name identifies the rule to delete
+				if len(r.Rule) != 5 || r.Rule["name"] != revsuit.ruleName() || r.Rule["flag_format"] != "" || r.Cookie != "token" {
+					t.Errorf("%s: delete payload %v", kind, r.Rule)
+				}
+			}
+			// a second Close does not delete again
+			if err := oob.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if _, n := f.ruleRequests(http.MethodDelete); n != 2 {
+				t.Errorf("deleted again: %d", n)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package oobadapter
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/zan8in/oobadapter/pkg/retryhttp"
+)
+
+var (
+	SelfTestTimeout      = 30 * time.Second // ctx 没有截止时间时的等待上限
+	SelfTestPollInterval = time.Second
+)
+
+// SelfTestResult is the round trip of one protocol.
+type SelfTestResult struct {
+	Protocol string        // dns, http
+	Target   string        // 触发的域名或 url
+	Detected bool          // 平台是否收到了交互
+	Latency  time.Duration // 从触发到检测到交互的耗时
+	Err      error         // 最后一次校验的错误，比如：*CircuitOpenError
+}
+
+// SelfTestReport is the outcome of SelfTest.
+type SelfTestReport struct {
+	DnslogType string
+	Passed     bool // 所有协议都检测到交互
+	Results    []SelfTestResult
+}
+
+// SelfTestOptions sets how SelfTestWith triggers the interactions.
+type SelfTestOptions struct {
+	Resolver *net.Resolver         // 触发 dns 查询的解析器，默认 net.DefaultResolver
+	Client   *retryhttp.HTTPClient // 触发 http 请求的客户端，默认使用 adapter 的客户端
+}
+
+// SelfTest allocates a validation domain per protocol, triggers a dns lookup through the Go
+// resolver and an http request through the adapter's client, then polls until the provider
+// reports each hit or ctx is done.
+func (o *OOBAdapter) SelfTest(ctx context.Context) SelfTestReport {
+	return o.SelfTestWith(ctx, SelfTestOptions{})
+}
+
+// SelfTestWith is SelfTest with the resolver and client of opts.
+func (o *OOBAdapter) SelfTestWith(ctx context.Context, opts SelfTestOptions) SelfTestReport {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, SelfTestTimeout)
+		defer cancel()
+	}
+
+	resolver := opts.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	client := opts.Client
+	if client == nil && o.Params != nil {
+		client, _ = o.Params.httpClient()
+	}
+	triggers := []struct {
+		protocol string
+		target   func(ValidationDomains) string
+		trigger  func(context.Context, string)
+	}{
+		{OOBDNS, func(d ValidationDomains) string { return d.DNS }, func(ctx context.Context, host string) {
+			// NXDOMAIN is fine, the query has already reached the provider's name server
+			_, _ = resolver.LookupHost(ctx, host)
+		}},
+		{OOBHTTP, func(d ValidationDomains) string { return d.HTTP }, func(ctx context.Context, target string) {
+			_, _ = client.Do(ctx, retryhttp.Request{URL: target})
+		}},
+	}
+
+	report := SelfTestReport{DnslogType: o.DnsLogType, Results: make([]SelfTestResult, len(triggers))}
+	var wg sync.WaitGroup
+	for i, t := range triggers {
+		d := o.GetValidationDomain()
+		target := t.target(d)
+		report.Results[i] = SelfTestResult{Protocol: t.protocol, Target: target}
+		if target == "" {
+			continue
+		}
+		wg.Add(1)
+		go func(r *SelfTestResult, trigger func(context.Context, string)) {
+			defer wg.Done()
+			start := time.Now()
+			trigger(ctx, target)
+			r.Detected, r.Err = o.waitFor(ctx, ValidateParams{
+				Filter:     d.Filter,
+				FilterType: r.Protocol,
+				IssuedAt:   d.IssuedAt,
+			})
+			r.Latency = time.Since(start)
+		}(&report.Results[i], t.trigger)
+	}
+	wg.Wait()
+
+	report.Passed = true
+	for _, r := range report.Results {
+		if !r.Detected {
+			report.Passed = false
+		}
+	}
+	return report
+}
+
+// waitFor polls ValidateResult until params hits or ctx is done.
+func (o *OOBAdapter) waitFor(ctx context.Context, params ValidateParams) (bool, error) {
+	ticker := time.NewTicker(SelfTestPollInterval)
+	defer ticker.Stop()
+	var err error
+	for {
+		res := o.ValidateResult(params)
+		if res.IsVaild {
+			return true, nil
+		}
+		err = res.Err
+		select {
+		case <-ctx.Done():
+			if err == nil {
+				err = ctx.Err()
+			}
+			return false, err
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package oobadapter
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zan8in/oobadapter/pkg/retryhttp"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// newRecordingResolver returns a resolver whose queries reach f as dns hits, answered NXDOMAIN.
+func newRecordingResolver(t *testing.T, f *fakeXray) *net.Resolver {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			var req dnsmessage.Message
+			if err := req.Unpack(buf[:n]); err != nil || len(req.Questions) == 0 {
+				continue
+			}
+			f.dnsHit(strings.TrimSuffix(req.Questions[0].Name.String(), "."))
+			resp := dnsmessage.Message{
+				Header:    dnsmessage.Header{ID: req.ID, Response: true, RCode: dnsmessage.RCodeNameError},
+				Questions: req.Questions,
+			}
+			if out, err := resp.Pack(); err == nil {
+				conn.WriteTo(out, addr)
+			}
+		}
+	}()
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			return net.Dial("udp", conn.LocalAddr().String())
+		},
+	}
+}
+
+// failTransport fails every request without sending it.
+type failTransport struct{}
+
+func (failTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	return nil, errors.New("unreachable")
+}
+
+func useSelfTestPollInterval(t *testing.T, d time.Duration) {
+	t.Helper()
+	prev := SelfTestPollInterval
+	SelfTestPollInterval = d
+	t.Cleanup(func() { SelfTestPollInterval = prev })
+}
+
+func TestSelfTestDetectsRoundTrip(t *testing.T) {
+	useSelfTestPollInterval(t, 20*time.Millisecond)
+	f := newFakeXray(t)
+	oob := newTestXrayAdapter(t, f, nil)
+	client, err := retryhttp.New(&retryhttp.Options{Retries: -1, Timeout: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	report := oob.SelfTestWith(ctx, SelfTestOptions{Resolver: newRecordingResolver(t, f), Client: client})
+	if !report.Passed || report.DnslogType != XrayName || len(report.Results) != 2 {
+		t.Fatalf("report: %+v", report)
+	}
+	for _, r := range report.Results {
+		if !r.Detected || r.Err != nil || r.Target == "" || r.Latency <= 0 {
+			t.Errorf("%s: %+v", r.Protocol, r)
+		}
+	}
+}
+
+func TestSelfTestTimeout(t *testing.T) {
+	useSelfTestPollInterval(t, 20*time.Millisecond)
+	f := newFakeXray(t)
+	oob := newTestXrayAdapter(t, f, nil)
+	client, err := retryhttp.New(&retryhttp.Options{Retries: -1, Timeout: 5, Transport: failTransport{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// nothing reaches the provider
+	resolver := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			return nil, errors.New("unreachable")
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	report := oob.SelfTestWith(ctx, SelfTestOptions{Resolver: resolver, Client: client})
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("self test took %s", elapsed)
+	}
+	if report.Passed {
+		t.Fatal("passed without interactions")
+	}
+	for _, r := range report.Results {
+		if r.Detected || !errors.Is(r.Err, context.DeadlineExceeded) {
+			t.Errorf("%s: %+v", r.Protocol, r)
+		}
+	}
+}
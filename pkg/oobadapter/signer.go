@@ -0,0 +1,143 @@
+package oobadapter
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var (
+	SignedNonceLength = 5 // bytes, 8 dns-safe chars
+	SignedMACLength   = 5 // bytes, 8 dns-safe chars
+
+	SignKeyFileSuffix = ".signkey" // 生成的签名密钥保存在 CorrelationFile 或 SessionFile 加该后缀的文件中
+)
+
+// signEncoding is lowercase base32, safe in dns labels and url paths.
+var signEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// filterSigner issues tokens made of a random nonce and a truncated HMAC of it,
+// so hits can be attributed to this adapter and spoofed or colliding filters rejected.
+type filterSigner struct {
+	key []byte
+}
+
+// newFilterSigner returns nil when key is empty, which disables signing.
+func newFilterSigner(key string) *filterSigner {
+	if key == "" {
+		return nil
+	}
+	return &filterSigner{key: []byte(key)}
+}
+
+// NewSignKey returns a random key for ConnectorParams.SignKey.
+func NewSignKey() string {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// loadSignKey returns the key saved in filename, or generates one and saves it there,
+// so filters issued before a restart still verify.
+func loadSignKey(filename string) (string, error) {
+	data, err := os.ReadFile(filename)
+	if err == nil {
+		if key := strings.TrimSpace(string(data)); key != "" {
+			return key, nil
+		}
+		return "", fmt.Errorf("empty sign key file: %s", filename)
+	}
+	if !os.IsNotExist(err) {
+		return "", err
+	}
+	key := NewSignKey()
+	if err := os.WriteFile(filename, []byte(key+"\n"), 0600); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// signKeyFile is where a generated key is kept, next to the files that outlive the process.
+func signKeyFile(dnslogType string, params *ConnectorParams) string {
+	if params.CorrelationFile != "" {
+		return params.CorrelationFile + SignKeyFileSuffix
+	}
+	if dnslogType == InteractshName && strings.TrimSpace(params.SessionFile) != "" {
+		return strings.TrimSpace(params.SessionFile) + SignKeyFileSuffix
+	}
+	return ""
+}
+
+func (s *filterSigner) mac(nonce []byte) []byte {
+	h := hmac.New(sha256.New, s.key)
+	h.Write(nonce)
+	return h.Sum(nil)[:SignedMACLength]
+}
+
+// token returns a signed token, or random unchanged when signing is disabled.
+func (s *filterSigner) token(random string) string {
+	if s == nil {
+		return random
+	}
+	nonce := make([]byte, SignedNonceLength)
+	_, _ = rand.Read(nonce)
+	return signEncoding.EncodeToString(append(nonce, s.mac(nonce)...))
+}
+
+// tokenLength is the length of tokens returned by token, n when signing is disabled.
+func (s *filterSigner) tokenLength(n int) int {
+	if s == nil {
+		return n
+	}
+	return signEncoding.EncodedLen(SignedNonceLength + SignedMACLength)
+}
+
+// Verify reports whether token was issued by this signer.
+func (s *filterSigner) Verify(token string) bool {
+	if s == nil {
+		return false
+	}
+	raw, err := signEncoding.DecodeString(strings.ToLower(token))
+	if err != nil || len(raw) != SignedNonceLength+SignedMACLength {
+		return false
+	}
+	return hmac.Equal(raw[SignedNonceLength:], s.mac(raw[:SignedNonceLength]))
+}
+
+// verifyFilter reports whether any label or path segment of filter is a signed token,
+// it always holds when signing is disabled or filter is empty.
+func (s *filterSigner) verifyFilter(filter string) bool {
+	if s == nil || filter == "" {
+		return true
+	}
+	return len(s.findTokens(filter)) > 0
+}
+
+// findTokens returns the signed tokens among the labels and path segments of v.
+func (s *filterSigner) findTokens(v string) []string {
+	if s == nil {
+		return nil
+	}
+	out := make([]string, 0, 1)
+	for _, part := range strings.FieldsFunc(v, func(r rune) bool { return r == '.' || r == '/' || r == '?' || r == '&' || r == '=' }) {
+		if s.Verify(part) {
+			out = append(out, strings.ToLower(part))
+		}
+	}
+	return out
+}
+
+// invalidSignature is the Result of a filter that was not issued by this adapter.
+func invalidSignature(dnslogType string, params ValidateParams) Result {
+	return Result{
+		IsVaild:    false,
+		DnslogType: dnslogType,
+		FilterType: params.FilterType,
+		Body:       "invalid filter signature",
+	}
+}
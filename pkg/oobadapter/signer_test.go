@@ -0,0 +1,52 @@
+package oobadapter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSignKeyPersisted(t *testing.T) {
+	f := newFakeXray(t)
+	correlationFile := filepath.Join(t.TempDir(), "correlations.jsonl")
+	params := func() *ConnectorParams {
+		return &ConnectorParams{SignFilters: true, CorrelationFile: correlationFile, RecordCacheTTL: -1}
+	}
+
+	first := newTestXrayAdapter(t, f, params())
+	d := first.GetValidationDomain()
+	f.dnsHit(d.DNS)
+	if res := first.ValidateResult(d.Params(OOBDNS)); !res.IsVaild {
+		t.Fatalf("first adapter: %s", res.Body)
+	}
+
+	// a restarted adapter loads the generated key and still accepts the filter
+	second := newTestXrayAdapter(t, f, params())
+	if second.Params.SignKey != first.Params.SignKey {
+		t.Fatal("sign key regenerated")
+	}
+	if res := second.ValidateResult(d.Params(OOBDNS)); !res.IsVaild {
+		t.Fatalf("second adapter: %s", res.Body)
+	}
+	if info, err := os.Stat(correlationFile + SignKeyFileSuffix); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("key file: %v %v", info, err)
+	}
+
+	// without a file to keep it next to, every adapter has its own key
+	other := newTestXrayAdapter(t, f, &ConnectorParams{SignFilters: true, RecordCacheTTL: -1})
+	if res := other.ValidateResult(d.Params(OOBDNS)); res.IsVaild {
+		t.Fatal("filter of another key accepted")
+	}
+}
+
+func TestSignKeyFile(t *testing.T) {
+	if got := signKeyFile(XrayName, &ConnectorParams{SessionFile: "session.yaml"}); got != "" {
+		t.Errorf("xray session file: %s", got)
+	}
+	if got := signKeyFile(InteractshName, &ConnectorParams{SessionFile: "session.yaml"}); got != "session.yaml"+SignKeyFileSuffix {
+		t.Errorf("interactsh session file: %s", got)
+	}
+	if got := signKeyFile(InteractshName, &ConnectorParams{SessionFile: "session.yaml", CorrelationFile: "c.jsonl"}); got != "c.jsonl"+SignKeyFileSuffix {
+		t.Errorf("correlation file: %s", got)
+	}
+}
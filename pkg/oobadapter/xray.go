@@ -1,9 +1,12 @@
 package oobadapter
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/zan8in/oobadapter/pkg/retryhttp"
 	randutil "github.com/zan8in/pins/rand"
@@ -27,6 +30,11 @@ type XrayConnector struct {
 	XrayHTTP      *Xray
 	XrayDNS       *Xray
 	IsAlive       bool
+	mu            sync.Mutex // guards IsAlive
+	signer        *filterSigner
+	http          *retryhttp.HTTPClient
+	fetches       *recordCache
+	issued        *issueLog
 }
 
 /*
@@ -68,8 +76,12 @@ type XrayData struct {
 }
 
 func NewXrayConnector(params *ConnectorParams) (*XrayConnector, error) {
+	client, err := params.httpClient()
+	if err != nil {
+		return nil, err
+	}
 	// fmt.Println(fmt.Sprintf("%s/_/api/cland/generate/dns_domain", params.ApiUrl))
-	status, body := retryhttp.GetWithHeader(fmt.Sprintf("%s/_/api/cland/generate/dns_domain", params.ApiUrl), map[string]string{
+	status, body := client.GetWithHeader(fmt.Sprintf("%s/_/api/cland/generate/dns_domain", params.ApiUrl), map[string]string{
 		"X-Token": params.Key,
 	})
 	if status == 0 {
@@ -82,7 +94,7 @@ func NewXrayConnector(params *ConnectorParams) (*XrayConnector, error) {
 	}
 
 	// fmt.Println(fmt.Sprintf("%s/_/api/cland/generate/http_url", params.ApiUrl))
-	status2, body2 := retryhttp.GetWithHeader(fmt.Sprintf("%s/_/api/cland/generate/http_url", params.ApiUrl), map[string]string{
+	status2, body2 := client.GetWithHeader(fmt.Sprintf("%s/_/api/cland/generate/http_url", params.ApiUrl), map[string]string{
 		"X-Token": params.Key,
 	})
 	if status2 == 0 {
@@ -104,22 +116,32 @@ func NewXrayConnector(params *ConnectorParams) (*XrayConnector, error) {
 			XrayDNS:       xrayDns,
 			ApiUrl:        params.ApiUrl,
 			IsAlive:       true,
+			signer:        newFilterSigner(params.SignKey),
+			http:          client,
+			fetches:       newRecordCache(params.RecordCacheTTL),
+			issued:        params.issueLog(),
 		}, nil
 	}
 	return nil, fmt.Errorf("new XrayConnector failed")
 }
 
 func (c *XrayConnector) GetValidationDomain() ValidationDomains {
-	randstr := randutil.Randcase(XraySubLength)
+	randstr := c.signer.token(randutil.Randcase(XraySubLength))
 	validationDomain := ValidationDomains{
-		HTTP:   fmt.Sprintf("%s/%s", strings.TrimSuffix(c.XrayHTTPUrl, "/"), randstr), // http://x.x.x.x:8777/p/369d50/K5W0/randstr
-		DNS:    fmt.Sprintf("%s.%s.%s", c.XrayDNSFilter, randstr, c.Domain),           // p-9a393c-iod8-randstr.dnslogxx.net
-		Filter: randstr,
+		HTTP:     fmt.Sprintf("%s/%s", strings.TrimSuffix(c.XrayHTTPUrl, "/"), randstr), // http://x.x.x.x:8777/p/369d50/K5W0/randstr
+		DNS:      fmt.Sprintf("%s.%s.%s", c.XrayDNSFilter, randstr, c.Domain),           // p-9a393c-iod8-randstr.dnslogxx.net
+		Filter:   randstr,
+		IssuedAt: time.Now(),
 	}
+	c.issued.add(validationDomain)
 	return validationDomain
 }
 
 func (c *XrayConnector) ValidateResult(params ValidateParams) Result {
+	params = c.issued.withIssuedAt(params)
+	if !c.signer.verifyFilter(params.Filter) {
+		return invalidSignature(XrayName, params)
+	}
 	switch c.GetFilterType(params.FilterType) {
 	case XrayDNS:
 		return c.validate(params)
@@ -143,30 +165,18 @@ func (c *XrayConnector) validate(params ValidateParams) Result {
 	if params.FilterType == OOBDNS {
 		url = fmt.Sprintf("%s/_/api/cland/event/list?lastID=&count=10&eventType=dns&action=Next", c.ApiUrl)
 	}
-	status, body := retryhttp.GetWithHeader(url, map[string]string{
-		"X-Token": c.XToken,
+	status, body := c.fetches.fetch(url, func() (int, []byte) {
+		return c.http.GetWithHeader(url, map[string]string{
+			"X-Token": c.XToken,
+		})
 	})
-	if status != 0 {
-		if params.FilterType == OOBHTTP {
-			// fmt.Println("OOBHTTP : ", getXrayHttpSuffix(c.XrayHTTPUrl)+"/"+params.Filter)
-			if strings.Contains(strings.ToLower(string(body)), strings.ToLower(getXrayHttpSuffix(c.XrayHTTPUrl)+"/"+params.Filter)) {
-				return Result{
-					IsVaild:    true,
-					DnslogType: AlphalogName,
-					FilterType: params.FilterType,
-					Body:       string(body),
-				}
-			}
-		}
-		if params.FilterType == OOBDNS {
-			// fmt.Println("OOBDNS : ", c.XrayDNSFilter+"."+params.Filter)
-			if strings.Contains(strings.ToLower(string(body)), strings.ToLower(c.XrayDNSFilter+"."+params.Filter)) {
-				return Result{
-					IsVaild:    true,
-					DnslogType: AlphalogName,
-					FilterType: params.FilterType,
-					Body:       string(body),
-				}
+	if status != 0 && (params.FilterType == OOBHTTP || params.FilterType == OOBDNS) {
+		if matchBody(XrayName, body, params.matcher(c.matcher(params))) {
+			return Result{
+				IsVaild:    true,
+				DnslogType: AlphalogName,
+				FilterType: params.FilterType,
+				Body:       string(body),
 			}
 		}
 	}
@@ -175,6 +185,21 @@ func (c *XrayConnector) validate(params ValidateParams) Result {
 		DnslogType: AlphalogName,
 		FilterType: params.FilterType,
 		Body:       string(body),
+		Err:        requestError(XrayName, status),
+	}
+}
+
+// matcher matches http hits on the /p/xxx/group/filter path and dns hits on the prefix.filter labels.
+func (c *XrayConnector) matcher(params ValidateParams) Matcher {
+	if params.FilterType == OOBHTTP {
+		return Matcher{
+			Filter:   strings.TrimPrefix(getXrayHttpSuffix(c.XrayHTTPUrl)+"/"+params.Filter, "/"),
+			Protocol: OOBHTTP,
+		}
+	}
+	return Matcher{
+		Filter:   c.XrayDNSFilter + "." + params.Filter,
+		Protocol: OOBDNS,
 	}
 }
 
@@ -199,7 +224,53 @@ func getXrayHttpSuffix(str string) string {
 
 func (c *XrayConnector) IsVaild() bool {
 	if c != nil {
+		c.mu.Lock()
+		defer c.mu.Unlock()
 		return c.IsAlive
 	}
 	return false
 }
+
+// Close drops the cached records and the idle connections.
+func (c *XrayConnector) Close() error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	if !c.IsAlive {
+		c.mu.Unlock()
+		return nil
+	}
+	c.IsAlive = false
+	c.mu.Unlock()
+	c.fetches.reset()
+	c.http.CloseIdleConnections()
+	return nil
+}
+
+// health checks the event api with the X-Token.
+func (c *XrayConnector) health(ctx context.Context) (HealthStep, HealthStep) {
+	api, resp := apiStep(ctx, c.http, retryhttp.Request{
+		URL:    fmt.Sprintf("%s/_/api/cland/event/list?lastID=&count=1&eventType=dns&action=Next", c.ApiUrl),
+		Header: map[string]string{"X-Token": c.XToken},
+	})
+	if resp == nil {
+		return api, credentialStep(nil, false, "")
+	}
+	msg, ok := apiError(resp.Body)
+	switch {
+	case !ok:
+		return api, credentialStep(resp, false, "invalid response")
+	case msg != "":
+		return api, credentialStep(resp, false, msg)
+	}
+	return api, credentialStep(resp, true, "token valid")
+}
+
+// delegation is the configured domain, which must point to the server xray reports.
+func (c *XrayConnector) delegation() (string, []string) {
+	if c.XrayDNS != nil && c.XrayDNS.Data.Server != "" {
+		return c.Domain, []string{c.XrayDNS.Data.Server}
+	}
+	return c.Domain, nil
+}
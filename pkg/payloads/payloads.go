@@ -0,0 +1,215 @@
+package payloads
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/zan8in/oobadapter/pkg/oobadapter"
+)
+
+var (
+	OSLinux   = "linux"
+	OSWindows = "windows"
+
+	ShellSh         = "sh"
+	ShellCmd        = "cmd"
+	ShellPowershell = "powershell"
+)
+
+// Context selects the variant of a payload for the target environment.
+type Context struct {
+	OS      string // 目标系统，比如：linux, windows，为空表示不限
+	Shell   string // 目标 shell，比如：sh, cmd, powershell，为空表示不限
+	Command string // 需要外带结果的命令，比如：whoami，用于 exfil 类模板
+}
+
+// Template is a named payload rendered with text/template. The data holds the fields of
+// ValidationDomains (.Filter .DNS .HTTP .JNDI .LDAP .RMI), .Host (host of .HTTP) and .Command.
+type Template struct {
+	Name     string   // 名称，比如：log4j-jndi-dns
+	Protocol string   // 命中时的协议，用于 ValidateParams.FilterType，比如：dns, http
+	OS       string   // 适用系统，为空表示通用
+	Shell    string   // 适用 shell，为空表示通用
+	Requires []string // 必须非空的字段，比如：LDAP, Command
+	Text     string   // 模板内容，比如：nslookup {{.DNS}}
+
+	tpl *template.Template
+}
+
+// Payload is a rendered template.
+type Payload struct {
+	Name     string
+	Protocol string
+	Value    string
+}
+
+type data struct {
+	oobadapter.ValidationDomains
+	Host    string
+	Command string
+}
+
+// Registry holds templates by name, one per OS/shell variant.
+type Registry struct {
+	mu        sync.RWMutex
+	templates map[string][]*Template
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		templates: make(map[string][]*Template),
+	}
+}
+
+// Default is preloaded with the built-in templates.
+var Default = newDefaultRegistry()
+
+func newDefaultRegistry() *Registry {
+	r := NewRegistry()
+	for _, t := range builtins {
+		if err := r.Register(t); err != nil {
+			panic(err)
+		}
+	}
+	return r
+}
+
+// Register adds t to the Default registry.
+func Register(t Template) error {
+	return Default.Register(t)
+}
+
+// Render renders name from the Default registry.
+func Render(name string, d oobadapter.ValidationDomains, ctx Context) (Payload, error) {
+	return Default.Render(name, d, ctx)
+}
+
+// Register adds t, replacing a template with the same name, OS and shell.
+func (r *Registry) Register(t Template) error {
+	if t.Name == "" {
+		return fmt.Errorf("payload template name is empty")
+	}
+	tpl, err := template.New(t.Name).Option("missingkey=error").Parse(t.Text)
+	if err != nil {
+		return fmt.Errorf("payload template %s: %w", t.Name, err)
+	}
+	t.tpl = tpl
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	list := r.templates[t.Name]
+	for i, old := range list {
+		if strings.EqualFold(old.OS, t.OS) && strings.EqualFold(old.Shell, t.Shell) {
+			list[i] = &t
+			return nil
+		}
+	}
+	r.templates[t.Name] = append(list, &t)
+	return nil
+}
+
+// Names returns the registered template names in order.
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]string, 0, len(r.templates))
+	for name := range r.templates {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// lookup returns the variant of name that best fits ctx: os and shell, then os, then generic.
+func (r *Registry) lookup(name string, ctx Context) *Template {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var best *Template
+	bestScore := -1
+	for _, t := range r.templates[name] {
+		if t.OS != "" && ctx.OS != "" && !strings.EqualFold(t.OS, ctx.OS) {
+			continue
+		}
+		if t.Shell != "" && ctx.Shell != "" && !strings.EqualFold(t.Shell, ctx.Shell) {
+			continue
+		}
+		score := 0
+		if t.OS != "" && strings.EqualFold(t.OS, ctx.OS) {
+			score += 2
+		}
+		if t.Shell != "" && strings.EqualFold(t.Shell, ctx.Shell) {
+			score++
+		}
+		if score > bestScore {
+			best, bestScore = t, score
+		}
+	}
+	return best
+}
+
+// Render renders the variant of name that fits ctx for d.
+func (r *Registry) Render(name string, d oobadapter.ValidationDomains, ctx Context) (Payload, error) {
+	t := r.lookup(name, ctx)
+	if t == nil {
+		return Payload{}, fmt.Errorf("payload template %s not found for os=%s shell=%s", name, ctx.OS, ctx.Shell)
+	}
+
+	v := data{ValidationDomains: d, Command: ctx.Command}
+	if u, err := url.Parse(d.HTTP); err == nil {
+		v.Host = u.Hostname()
+	}
+	for _, field := range t.Requires {
+		if fieldValue(v, field) == "" {
+			return Payload{}, fmt.Errorf("payload template %s requires %s", name, field)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := t.tpl.Execute(&buf, v); err != nil {
+		return Payload{}, err
+	}
+	return Payload{
+		Name:     t.Name,
+		Protocol: t.Protocol,
+		Value:    buf.String(),
+	}, nil
+}
+
+// RenderAll renders every template that fits ctx and d, skipping those missing required fields.
+func (r *Registry) RenderAll(d oobadapter.ValidationDomains, ctx Context) []Payload {
+	out := make([]Payload, 0)
+	for _, name := range r.Names() {
+		if p, err := r.Render(name, d, ctx); err == nil {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+func fieldValue(v data, field string) string {
+	switch strings.ToLower(field) {
+	case "filter":
+		return v.Filter
+	case "dns":
+		return v.DNS
+	case "http":
+		return v.HTTP
+	case "jndi":
+		return v.JNDI
+	case "ldap":
+		return v.LDAP
+	case "rmi":
+		return v.RMI
+	case "host":
+		return v.Host
+	case "command":
+		return v.Command
+	default:
+		return ""
+	}
+}
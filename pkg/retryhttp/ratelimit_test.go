@@ -0,0 +1,174 @@
+package retryhttp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newCountingServer(t *testing.T, handler http.HandlerFunc) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var n atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n.Add(1)
+		if handler != nil {
+			handler(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &n
+}
+
+func TestRateLimitStdClient(t *testing.T) {
+	srv, n := newCountingServer(t, nil)
+	c, err := New(&Options{Retries: -1, Timeout: 5, RateLimit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the net/http client handed to interactsh is limited as well
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		resp, err := c.StdClient().Get(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("3 requests at 10/s took %s", elapsed)
+	}
+	if got := n.Load(); got != 3 {
+		t.Errorf("requests: %d", got)
+	}
+}
+
+func TestRateLimitCancel(t *testing.T) {
+	srv, n := newCountingServer(t, nil)
+	c, err := New(&Options{Retries: -1, Timeout: 5, RateLimit: 0.1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Do(context.Background(), Request{URL: srv.URL}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the next token is 10s away, cancellation must abort the wait and the request
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = c.Do(ctx, Request{URL: srv.URL})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("cancelled request took %s", elapsed)
+	}
+	if got := n.Load(); got != 1 {
+		t.Errorf("requests: %d, want 1", got)
+	}
+}
+
+func TestRateLimitRetryAfter(t *testing.T) {
+	var throttled atomic.Bool
+	srv, _ := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if throttled.CompareAndSwap(false, true) {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	})
+	c, err := New(&Options{Retries: -1, Timeout: 5, RateLimit: 100, RateBurst: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := c.StdClient().Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	start := time.Now()
+	if _, err := c.Do(context.Background(), Request{URL: srv.URL}); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 900*time.Millisecond {
+		t.Errorf("request after Retry-After: 1 sent after %s", elapsed)
+	}
+}
+
+func TestRetryNonIdempotent(t *testing.T) {
+	cases := []struct {
+		method     string
+		status     int
+		retryAfter string
+		requests   int32
+	}{
+		{http.MethodGet, http.StatusServiceUnavailable, "0", 2},
+		{http.MethodGet, http.StatusTooManyRequests, "0", 2},
+		{http.MethodPut, http.StatusServiceUnavailable, "0", 1},
+		{http.MethodPost, http.StatusServiceUnavailable, "0", 1},
+		{http.MethodPost, http.StatusTooManyRequests, "", 1},
+		{http.MethodPost, http.StatusTooManyRequests, "0", 2},
+		{http.MethodDelete, http.StatusTooManyRequests, "0", 2},
+	}
+	for _, c := range cases {
+		var first atomic.Bool
+		srv, n := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+			if first.CompareAndSwap(false, true) {
+				if c.retryAfter != "" {
+					w.Header().Set("Retry-After", c.retryAfter)
+				}
+				w.WriteHeader(c.status)
+			}
+		})
+		client, err := New(&Options{Retries: 1, Timeout: 5})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := client.Do(context.Background(), Request{Method: c.method, URL: srv.URL, Body: "a=1"}); err != nil {
+			t.Fatalf("%s %d: %v", c.method, c.status, err)
+		}
+		if got := n.Load(); got != c.requests {
+			t.Errorf("%s %d Retry-After %q: %d requests, want %d", c.method, c.status, c.retryAfter, got, c.requests)
+		}
+	}
+}
+
+func TestRetryConnectionErrors(t *testing.T) {
+	// the server reads the request and drops the connection
+	srv, n := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err == nil {
+			conn.Close()
+		}
+	})
+	c, err := New(&Options{Retries: 1, Timeout: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Do(context.Background(), Request{Method: http.MethodPost, URL: srv.URL, Body: "a=1"}); err == nil {
+		t.Fatal("dropped connection succeeded")
+	}
+	if got := n.Load(); got != 1 {
+		t.Errorf("post sent %d times", got)
+	}
+
+	// a request that never reached the server is sent again
+	policy := retryPolicy()
+	dialErr := errors.New("dial tcp 127.0.0.1:1: connect: connection refused")
+	ctx := withAttempt(context.Background(), http.MethodPost)
+	if ok, _ := policy(ctx, nil, dialErr); !ok {
+		t.Error("post not retried after a dial error")
+	}
+	ctx.Value(attemptKey{}).(*attemptState).sent.Store(true)
+	if ok, _ := policy(ctx, nil, dialErr); ok {
+		t.Error("post retried after it was sent")
+	}
+	if ok, _ := policy(withAttempt(context.Background(), http.MethodGet), nil, dialErr); !ok {
+		t.Error("get not retried after a dial error")
+	}
+}
@@ -0,0 +1,148 @@
+package retryhttp
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ErrPinMismatch is returned when no certificate of the server matches Options.PinnedSPKI.
+var ErrPinMismatch = errors.New("no certificate matches the pinned spki")
+
+// newTLSConfig builds the tls config of New. Like the globals it skips certificate
+// verification unless VerifyTLS or RootCAFile is set. Pinned SPKI hashes replace chain
+// verification unless verification is on, in which case the chain must verify against
+// RootCAFile or the system roots and a pin must match a certificate of the verified chain.
+// Without chain verification only the leaf is pinned, the other certificates sent by the
+// server prove nothing.
+func newTLSConfig(opts *Options) (*tls.Config, error) {
+	config := &tls.Config{
+		Renegotiation:      tls.RenegotiateOnceAsClient,
+		InsecureSkipVerify: opts.InsecureSkipVerify || (!opts.VerifyTLS && opts.RootCAFile == ""),
+		MinVersion:         tls.VersionTLS10,
+	}
+
+	if opts.RootCAFile != "" {
+		data, err := os.ReadFile(opts.RootCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificate found in %s", opts.RootCAFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if opts.ClientCertFile != "" || opts.ClientKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(opts.ClientCertFile, opts.ClientKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	if len(opts.PinnedSPKI) > 0 {
+		pins := make([][]byte, 0, len(opts.PinnedSPKI))
+		for _, pin := range opts.PinnedSPKI {
+			b, err := decodePin(pin)
+			if err != nil {
+				return nil, err
+			}
+			pins = append(pins, b)
+		}
+		verifyChain := (opts.VerifyTLS || opts.RootCAFile != "") && !opts.InsecureSkipVerify
+		roots := config.RootCAs
+		if verifyChain && roots == nil {
+			pool, err := x509.SystemCertPool()
+			if err != nil {
+				return nil, err
+			}
+			roots = pool
+		}
+		config.InsecureSkipVerify = true
+		config.VerifyConnection = func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 {
+				return fmt.Errorf("no peer certificate")
+			}
+			if !verifyChain {
+				return verifyPins(cs.ServerName, cs.PeerCertificates[:1], pins)
+			}
+			chains, err := verifyPeerChain(cs, roots)
+			if err != nil {
+				return err
+			}
+			var certs []*x509.Certificate
+			for _, chain := range chains {
+				certs = append(certs, chain...)
+			}
+			return verifyPins(cs.ServerName, certs, pins)
+		}
+	}
+	return config, nil
+}
+
+// decodePin accepts sha256/<base64>, <base64> or <hex>.
+func decodePin(pin string) ([]byte, error) {
+	pin = strings.TrimPrefix(strings.TrimSpace(pin), "sha256/")
+	if b, err := base64.StdEncoding.DecodeString(pin); err == nil && len(b) == sha256.Size {
+		return b, nil
+	}
+	if b, err := hex.DecodeString(strings.ReplaceAll(pin, ":", "")); err == nil && len(b) == sha256.Size {
+		return b, nil
+	}
+	return nil, fmt.Errorf("invalid spki pin: %s", pin)
+}
+
+// isCertificateError reports whether err comes from the verification of the server
+// certificate, which a retry cannot fix.
+func isCertificateError(err error) bool {
+	var verifyErr *tls.CertificateVerificationError
+	var authorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+	return errors.Is(err, ErrPinMismatch) ||
+		errors.As(err, &verifyErr) ||
+		errors.As(err, &authorityErr) ||
+		errors.As(err, &hostnameErr) ||
+		errors.As(err, &invalidErr)
+}
+
+// SPKIHash returns the pin of cert in the sha256/<base64> form accepted by Options.PinnedSPKI.
+func SPKIHash(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return "sha256/" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// verifyPins reports whether one of certs matches a pin.
+func verifyPins(serverName string, certs []*x509.Certificate, pins [][]byte) error {
+	for _, cert := range certs {
+		sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+		for _, pin := range pins {
+			if subtle.ConstantTimeCompare(sum[:], pin) == 1 {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("%s: %w", serverName, ErrPinMismatch)
+}
+
+// verifyPeerChain verifies the peer certificates against roots and returns the verified chains.
+func verifyPeerChain(cs tls.ConnectionState, roots *x509.CertPool) ([][]*x509.Certificate, error) {
+	opts := x509.VerifyOptions{
+		DNSName:       cs.ServerName,
+		Roots:         roots,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	return cs.PeerCertificates[0].Verify(opts)
+}
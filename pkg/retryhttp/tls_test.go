@@ -0,0 +1,243 @@
+package retryhttp
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	der  []byte
+	key  *ecdsa.PrivateKey
+}
+
+func (c testCert) tlsCert(chain ...testCert) tls.Certificate {
+	out := tls.Certificate{Certificate: [][]byte{c.der}, PrivateKey: c.key, Leaf: c.cert}
+	for _, extra := range chain {
+		out.Certificate = append(out.Certificate, extra.der)
+	}
+	return out
+}
+
+// newTestCert issues a certificate for 127.0.0.1, self-signed when parent is nil.
+func newTestCert(t *testing.T, name string, parent *testCert, isCA bool) testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	signer, signerKey := tmpl, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testCert{cert: cert, der: der, key: key}
+}
+
+func writePEM(t *testing.T, name, typ string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func newTLSServer(t *testing.T, config *tls.Config) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	srv.TLS = config
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func get(t *testing.T, opts *Options, target string) error {
+	t.Helper()
+	opts.Retries = -1 // a single attempt
+	opts.Timeout = 5
+	c, err := New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := c.Do(context.Background(), Request{URL: target})
+	if err == nil && resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("status: %d", resp.StatusCode)
+	}
+	return err
+}
+
+func TestTLSRootCA(t *testing.T) {
+	ca := newTestCert(t, "ca", nil, true)
+	leaf := newTestCert(t, "leaf", &ca, false)
+	srv := newTLSServer(t, &tls.Config{Certificates: []tls.Certificate{leaf.tlsCert()}})
+
+	if err := get(t, &Options{VerifyTLS: true}, srv.URL); err == nil {
+		t.Fatal("unknown ca accepted")
+	}
+	if err := get(t, &Options{RootCAFile: writePEM(t, "ca.pem", "CERTIFICATE", ca.der)}, srv.URL); err != nil {
+		t.Fatal(err)
+	}
+	other := newTestCert(t, "other", nil, true)
+	if err := get(t, &Options{RootCAFile: writePEM(t, "other.pem", "CERTIFICATE", other.der)}, srv.URL); err == nil {
+		t.Fatal("certificate of another ca accepted")
+	}
+}
+
+func TestTLSVerifyDefault(t *testing.T) {
+	self := newTestCert(t, "self", nil, false)
+	srv := newTLSServer(t, &tls.Config{Certificates: []tls.Certificate{self.tlsCert()}})
+
+	// same as the globals, a proxy or a rate limit alone must not turn on verification
+	if err := get(t, &Options{}, srv.URL); err != nil {
+		t.Fatal(err)
+	}
+	if err := get(t, &Options{RateLimit: 100}, srv.URL); err != nil {
+		t.Fatal(err)
+	}
+	if err := get(t, &Options{VerifyTLS: true}, srv.URL); err == nil {
+		t.Fatal("self-signed certificate accepted")
+	}
+	if err := get(t, &Options{VerifyTLS: true, InsecureSkipVerify: true}, srv.URL); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTLSPinnedSPKI(t *testing.T) {
+	self := newTestCert(t, "self", nil, false)
+	srv := newTLSServer(t, &tls.Config{Certificates: []tls.Certificate{self.tlsCert()}})
+
+	if err := get(t, &Options{PinnedSPKI: []string{SPKIHash(self.cert)}}, srv.URL); err != nil {
+		t.Fatal(err)
+	}
+	other := newTestCert(t, "other", nil, false)
+	err := get(t, &Options{PinnedSPKI: []string{SPKIHash(other.cert)}}, srv.URL)
+	if !errors.Is(err, ErrPinMismatch) {
+		t.Fatalf("want ErrPinMismatch, got %v", err)
+	}
+}
+
+// TestTLSPinnedSPKIAppendedCertificate serves an attacker leaf followed by the pinned
+// certificate, which must not satisfy the pin since the chain is not verified.
+func TestTLSPinnedSPKIAppendedCertificate(t *testing.T) {
+	pinned := newTestCert(t, "real", nil, false)
+	attacker := newTestCert(t, "attacker", nil, false)
+	srv := newTLSServer(t, &tls.Config{Certificates: []tls.Certificate{attacker.tlsCert(pinned)}})
+
+	err := get(t, &Options{PinnedSPKI: []string{SPKIHash(pinned.cert)}}, srv.URL)
+	if !errors.Is(err, ErrPinMismatch) {
+		t.Fatalf("want ErrPinMismatch, got %v", err)
+	}
+}
+
+func TestTLSPinnedSPKIWithRootCA(t *testing.T) {
+	ca := newTestCert(t, "ca", nil, true)
+	leaf := newTestCert(t, "leaf", &ca, false)
+	caFile := writePEM(t, "ca.pem", "CERTIFICATE", ca.der)
+	srv := newTLSServer(t, &tls.Config{Certificates: []tls.Certificate{leaf.tlsCert()}})
+
+	// the ca is part of the verified chain, so pinning it is enough
+	if err := get(t, &Options{RootCAFile: caFile, PinnedSPKI: []string{SPKIHash(ca.cert)}}, srv.URL); err != nil {
+		t.Fatal(err)
+	}
+
+	// a certificate appended by the server is not part of the verified chain
+	stray := newTestCert(t, "stray", nil, false)
+	srv = newTLSServer(t, &tls.Config{Certificates: []tls.Certificate{leaf.tlsCert(stray)}})
+	err := get(t, &Options{RootCAFile: caFile, PinnedSPKI: []string{SPKIHash(stray.cert)}}, srv.URL)
+	if !errors.Is(err, ErrPinMismatch) {
+		t.Fatalf("want ErrPinMismatch, got %v", err)
+	}
+
+	// the pin does not replace chain verification when a root ca is set
+	self := newTestCert(t, "self", nil, false)
+	srv = newTLSServer(t, &tls.Config{Certificates: []tls.Certificate{self.tlsCert()}})
+	if err := get(t, &Options{RootCAFile: caFile, PinnedSPKI: []string{SPKIHash(self.cert)}}, srv.URL); err == nil {
+		t.Fatal("pinned certificate of an unknown ca accepted")
+	}
+}
+
+// TestTLSPinnedSPKIWithVerifyTLS pins a self-signed certificate with VerifyTLS, the pin
+// must not replace verification against the system roots.
+func TestTLSPinnedSPKIWithVerifyTLS(t *testing.T) {
+	self := newTestCert(t, "self", nil, false)
+	srv := newTLSServer(t, &tls.Config{Certificates: []tls.Certificate{self.tlsCert()}})
+
+	err := get(t, &Options{VerifyTLS: true, PinnedSPKI: []string{SPKIHash(self.cert)}}, srv.URL)
+	if err == nil {
+		t.Fatal("pinned certificate that does not verify accepted")
+	}
+	if errors.Is(err, ErrPinMismatch) || !isCertificateError(err) {
+		t.Fatalf("want a verification error, got %v", err)
+	}
+	// InsecureSkipVerify still leaves only the pin
+	if err := get(t, &Options{VerifyTLS: true, InsecureSkipVerify: true, PinnedSPKI: []string{SPKIHash(self.cert)}}, srv.URL); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTLSClientCertificate(t *testing.T) {
+	ca := newTestCert(t, "ca", nil, true)
+	leaf := newTestCert(t, "leaf", &ca, false)
+	client := newTestCert(t, "client", &ca, false)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	srv := newTLSServer(t, &tls.Config{
+		Certificates: []tls.Certificate{leaf.tlsCert()},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	})
+	caFile := writePEM(t, "ca.pem", "CERTIFICATE", ca.der)
+
+	if err := get(t, &Options{RootCAFile: caFile}, srv.URL); err == nil {
+		t.Fatal("request without client certificate accepted")
+	}
+	keyDER, err := x509.MarshalECPrivateKey(client.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := &Options{
+		RootCAFile:     caFile,
+		ClientCertFile: writePEM(t, "client.pem", "CERTIFICATE", client.der),
+		ClientKeyFile:  writePEM(t, "client.key", "EC PRIVATE KEY", keyDER),
+	}
+	if err := get(t, opts, srv.URL); err != nil {
+		t.Fatal(err)
+	}
+}